@@ -0,0 +1,68 @@
+package golet
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Default values of Backoff.
+const (
+	defaultBackoffInitial    = 100 * time.Millisecond
+	defaultBackoffMax        = 30 * time.Second
+	defaultBackoffMultiplier = 2.0
+	defaultBackoffResetAfter = 10 * time.Second
+)
+
+// Backoff configures the delay between restarts of a service.
+// Zero fields are replaced by the default values.
+type Backoff struct {
+	Initial    time.Duration // Delay before the first restart. 100ms by default.
+	Max        time.Duration // Upper limit of the delay. 30s by default.
+	Multiplier float64       // Factor to grow the delay on each restart. 2 by default.
+	Jitter     float64       // Randomization factor (0.0 - 1.0) of the delay. 0 by default.
+	ResetAfter time.Duration // Reset the delay if the service has been running longer than this. 10s by default.
+}
+
+func (b Backoff) withDefaults() Backoff {
+	if b.Initial <= 0 {
+		b.Initial = defaultBackoffInitial
+	}
+	if b.Max <= 0 {
+		b.Max = defaultBackoffMax
+	}
+	if b.Multiplier < 1 {
+		b.Multiplier = defaultBackoffMultiplier
+	}
+	if b.ResetAfter <= 0 {
+		b.ResetAfter = defaultBackoffResetAfter
+	}
+	return b
+}
+
+// backoff holds the state of the delay for each worker.
+type backoff struct {
+	Backoff
+	delay time.Duration
+}
+
+func newBackoff(b Backoff) *backoff {
+	return &backoff{Backoff: b.withDefaults()}
+}
+
+// next returns the delay before the next restart.
+// ran is the duration the service was running before it exited.
+func (b *backoff) next(ran time.Duration) time.Duration {
+	if b.delay == 0 || ran >= b.ResetAfter {
+		b.delay = b.Initial
+	} else {
+		b.delay = time.Duration(float64(b.delay) * b.Multiplier)
+	}
+	if b.delay > b.Max {
+		b.delay = b.Max
+	}
+	d := float64(b.delay)
+	if b.Jitter > 0 {
+		d += d * b.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(d)
+}
@@ -0,0 +1,275 @@
+// Command golet runs services defined in a file like a supervisor.
+// The file is a Procfile if its name starts with "Procfile", otherwise YAML, TOML or JSON
+// decided by its extension. See golet.LoadConfig for the format.
+//
+//	golet [options]                 run services
+//	golet [options] status          show status of workers
+//	golet [options] start <name>    start stopped workers
+//	golet [options] restart <name>  restart workers
+//	golet [options] rolling-restart <tag>  restart workers a few at a time
+//	golet [options] stop <name>     stop workers
+//	golet [options] logs <name>     follow logs of workers
+//	golet [options] scale <tag> <n> change the number of workers
+//	golet [options] reload          reload services from the file
+//
+// name is the tag of a service, or the ID of a worker like "web.0".
+// Subcommands talk to the running golet through its control socket.
+// Sending SIGHUP to golet reloads the file too, unless it is a Procfile.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Code-Hex/golet"
+	"github.com/Code-Hex/golet/control"
+)
+
+type options struct {
+	file            string
+	formation       string
+	envFile         string
+	socket          string
+	interval        time.Duration
+	color           bool
+	quiet           bool
+	noExecNotice    bool
+	exitOnFatal     bool
+	shutdownTimeout time.Duration
+	rollingSignal   string
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	var opts options
+	fs := flag.NewFlagSet("golet", flag.ContinueOnError)
+	fs.StringVar(&opts.file, "f", "golet.yaml", "file of service definitions (Procfile, .yaml, .toml or .json)")
+	fs.StringVar(&opts.formation, "m", "", "formation like web=2,worker=3 (all=N for the rest)")
+	fs.StringVar(&opts.envFile, "e", "", "comma separated dotenv files for all services of Procfile")
+	fs.StringVar(&opts.socket, "s", "golet.sock", "path of the control socket")
+	fs.DurationVar(&opts.interval, "interval", 0, "interval between spawning services")
+	fs.BoolVar(&opts.color, "color", false, "colored log")
+	fs.BoolVar(&opts.quiet, "quiet", false, "disable logs of services")
+	fs.BoolVar(&opts.noExecNotice, "no-exec-notice", false, "disable execute notifications")
+	fs.BoolVar(&opts.exitOnFatal, "exit-on-fatal", false, "stop all services when a service entered FATAL state")
+	fs.DurationVar(&opts.shutdownTimeout, "shutdown-timeout", 0, "deadline to wait for all services to finish on shutdown")
+	fs.StringVar(&opts.rollingSignal, "rolling-restart-signal", "", "signal to restart all services a few workers at a time (e.g. USR2)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: golet [options] [status|reload|start|restart|rolling-restart|stop|logs <name>|scale <tag> <n>]\n\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var err error
+	switch cmd := fs.Arg(0); cmd {
+	case "", "run":
+		return runServices(opts, set)
+	case "status":
+		err = status(opts.socket)
+	case "reload":
+		err = reload(opts.socket)
+	case "start", "restart", "rolling-restart", "stop", "logs":
+		if fs.NArg() != 2 {
+			fs.Usage()
+			return 2
+		}
+		err = action(opts.socket, cmd, fs.Arg(1))
+	case "scale":
+		n, aerr := strconv.Atoi(fs.Arg(2))
+		if fs.NArg() != 3 || aerr != nil {
+			fs.Usage()
+			return 2
+		}
+		err = scale(opts.socket, fs.Arg(1), n)
+	default:
+		fmt.Fprintf(os.Stderr, "golet: unknown command: %s\n", cmd)
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "golet: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runServices runs services defined in the file until they finish.
+// Options given by flags take priority over ones in the file.
+func runServices(opts options, set map[string]bool) int {
+	p, err := load(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "golet: %s\n", err)
+		return 1
+	}
+	// control_socket in the file takes priority over the default of the flag.
+	if set["s"] || p.ControlSocket() == "" {
+		p.SetControlSocket(opts.socket)
+	}
+	if set["interval"] {
+		p.SetInterval(opts.interval)
+	}
+	if set["shutdown-timeout"] {
+		p.SetShutdownTimeout(opts.shutdownTimeout)
+	}
+	if opts.color {
+		p.EnableColor()
+	}
+	if opts.quiet {
+		p.DisableLogger()
+	}
+	if opts.noExecNotice {
+		p.DisableExecNotice()
+	}
+	if opts.exitOnFatal {
+		p.EnableExitOnFatal()
+	}
+	if opts.rollingSignal != "" {
+		sig, err := golet.ParseSignal(opts.rollingSignal)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "golet: %s\n", err)
+			return 2
+		}
+		p.SetRollingRestartSignal(sig)
+	}
+	if err := p.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		var runErr *golet.RunError
+		if errors.As(err, &runErr) {
+			return runErr.ExitCode()
+		}
+		return 1
+	}
+	return 0
+}
+
+// load creates the runner from the Procfile or the config file.
+func load(opts options) (golet.Runner, error) {
+	if !strings.HasPrefix(filepath.Base(opts.file), "Procfile") {
+		if opts.formation != "" {
+			return nil, errors.New("formation is only for Procfile")
+		}
+		if opts.envFile != "" {
+			return nil, errors.New("use env_file in " + opts.file + " instead of -e")
+		}
+		return golet.LoadConfig(opts.file)
+	}
+	services, err := golet.LoadProcfile(opts.file)
+	if err != nil {
+		return nil, err
+	}
+	if opts.formation != "" {
+		f, err := golet.ParseFormation(opts.formation)
+		if err != nil {
+			return nil, err
+		}
+		if services, err = f.Apply(services); err != nil {
+			return nil, err
+		}
+	}
+	p := golet.New(context.Background())
+	if opts.envFile != "" {
+		if err := p.EnvFile(strings.Split(opts.envFile, ",")...); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.Add(services...); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// status prints status of workers of the running golet.
+func status(socket string) error {
+	services, err := control.New(socket).Services(context.Background())
+	if err != nil {
+		return err
+	}
+	printServices(services)
+	return nil
+}
+
+// reload makes the running golet reload services from its file.
+func reload(socket string) error {
+	services, err := control.New(socket).Reload(context.Background())
+	if err != nil {
+		return err
+	}
+	printServices(services)
+	return nil
+}
+
+// scale changes the number of workers of the service of the running golet.
+func scale(socket, tag string, n int) error {
+	services, err := control.New(socket).Scale(context.Background(), tag, n)
+	if err != nil {
+		return err
+	}
+	printServices(services)
+	return nil
+}
+
+// action performs the command to workers of the running golet.
+func action(socket, cmd, name string) error {
+	c := control.New(socket)
+	ctx := context.Background()
+	var (
+		services []control.Service
+		err      error
+	)
+	switch cmd {
+	case "start":
+		services, err = c.Start(ctx, name)
+	case "restart":
+		services, err = c.Restart(ctx, name)
+	case "rolling-restart":
+		services, err = c.RollingRestart(ctx, name)
+	case "stop":
+		services, err = c.Stop(ctx, name)
+	case "logs":
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sigs
+			cancel()
+		}()
+		return c.Logs(ctx, name, os.Stdout)
+	}
+	if err != nil {
+		return err
+	}
+	printServices(services)
+	return nil
+}
+
+func printServices(services []control.Service) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tKIND\tSTATE\tPID\tPORT\tRESTARTS\tUPTIME\tERROR")
+	for _, s := range services {
+		uptime := "-"
+		if s.State == "RUNNING" && !s.StartedAt.IsZero() {
+			uptime = time.Since(s.StartedAt).Round(time.Second).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\n", s.ID, s.Kind, s.State, s.PID, s.Port, s.Restarts, uptime, s.Error)
+	}
+	w.Flush()
+}
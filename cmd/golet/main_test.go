@@ -0,0 +1,57 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golet")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+	procfile := write("Procfile.dev", "web: true\n")
+	config := write("golet.yaml", "services:\n  - tag: web\n    exec: \"true\"\n")
+	critical := write("critical.yaml", "services:\n  - tag: web\n    exec: exit 3\n    critical: true\n    restart: never\n")
+	killed := write("killed.yaml", "services:\n  - tag: web\n    exec: kill -KILL $$\n    critical: true\n    restart: never\n")
+	socket := filepath.Join(dir, "golet.sock")
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"unknown flag", []string{"-unknown"}, 2},
+		{"unknown command", []string{"unknown"}, 2},
+		{"action without name", []string{"restart"}, 2},
+		{"action with extra args", []string{"stop", "web", "worker"}, 2},
+		{"scale without number", []string{"scale", "web"}, 2},
+		{"scale with invalid number", []string{"scale", "web", "two"}, 2},
+		{"scale with extra args", []string{"scale", "web", "2", "3"}, 2},
+		{"scale without golet", []string{"-s", socket, "scale", "web", "2"}, 1},
+		{"status without golet", []string{"-s", socket, "status"}, 1},
+		{"unknown signal", []string{"-s", socket, "-f", config, "-rolling-restart-signal", "BOGUS"}, 2},
+		{"missing file", []string{"-s", socket, "-f", filepath.Join(dir, "missing.yaml")}, 1},
+		{"Procfile", []string{"-s", socket, "-f", procfile, "-m", "web=2", "-quiet"}, 0},
+		{"unknown formation", []string{"-s", socket, "-f", procfile, "-m", "worker=2", "-quiet"}, 1},
+		{"config file", []string{"-s", socket, "-f", config, "-quiet"}, 0},
+		{"formation for config file", []string{"-s", socket, "-f", config, "-m", "web=2"}, 1},
+		{"env file for config file", []string{"-s", socket, "-f", config, "-e", ".env"}, 1},
+		{"exit code of critical service", []string{"-s", socket, "-f", critical, "-quiet"}, 3},
+		{"signal of critical service", []string{"-s", socket, "-f", killed, "-quiet"}, 128 + 9},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, run(tt.args), tt.name)
+	}
+}
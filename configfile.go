@@ -0,0 +1,475 @@
+package golet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ConfigError is the error of a config file. Key is the path of the offending key like "services[0].restart".
+type ConfigError struct {
+	File string
+	Key  string
+	Msg  string
+}
+
+func (e *ConfigError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("%s: %s", e.File, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.File, e.Key, e.Msg)
+}
+
+// LoadConfig creates a Runner from the config file, and adds services defined in it.
+// The format is decided by the extension: ".yaml", ".yml", ".toml" or ".json".
+// Relative paths of "env_file" and "dir" are relative to the directory of the config file.
+// The Runner reloads services from the file on SIGHUP instead of stopping them. See Reload.
+// The Runner is created with context.Background, so it has no key for SetCtxCancelSignal.
+//
+//	interval: 1s
+//	color: true
+//	env_file: .env
+//	services:
+//	  - tag: web
+//	    exec: plackup --port $PORT
+//	    worker: 2
+//	    dir: ./app
+//	    restart: always
+//	    env:
+//	      PLACK_ENV: production
+//	  - tag: cron
+//	    exec: ./batch.sh
+//	    every: "@hourly"
+//	    depends_on: [web]
+func LoadConfig(path string) (Runner, error) {
+	c := New(context.Background()).(*config)
+	services, err := decodeConfig(path, c)
+	if err != nil {
+		signal.Stop(c.ctx.sigchan)
+		return nil, err
+	}
+	if c.rollingSignal != 0 {
+		c.SetRollingRestartSignal(c.rollingSignal)
+	}
+	c.configTags = map[string]bool{}
+	for i, service := range services {
+		if err := c.Add(service); err != nil {
+			signal.Stop(c.ctx.sigchan)
+			return nil, &ConfigError{File: path, Key: fmt.Sprintf("services[%d]", i), Msg: err.Error()}
+		}
+		c.configTags[service.Tag] = true
+	}
+	c.configPath = path
+	return c, nil
+}
+
+// decodeConfig reads options of the runner in the config file into c, and returns services defined in it.
+// Services without tag are tagged by their position like Add does for a new Runner.
+func decodeConfig(path string, c *config) ([]Service, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &m)
+	case ".toml":
+		_, err = toml.Decode(string(b), &m)
+	case ".json":
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.UseNumber()
+		err = d.Decode(&m)
+	default:
+		return nil, &ConfigError{File: path, Msg: fmt.Sprintf("unknown format: %q", ext)}
+	}
+	if err != nil {
+		return nil, &ConfigError{File: path, Msg: err.Error()}
+	}
+	d := &configDecoder{dir: filepath.Dir(path)}
+	services := d.runner(c, newTable(d, "", m))
+	if d.err != nil {
+		d.err.File = path
+		return nil, d.err
+	}
+	for i := range services {
+		if services[i].Tag == "" {
+			services[i].Tag = strconv.Itoa(i + 1)
+		}
+	}
+	return services, nil
+}
+
+// configDecoder decodes tables of the config file, and keeps the first error.
+type configDecoder struct {
+	dir string // directory of the config file.
+	err *ConfigError
+}
+
+// resolve returns the path relative to the directory of the config file.
+func (d *configDecoder) resolve(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(d.dir, path)
+}
+
+// runner applies options of the runner, and returns services in the config.
+func (d *configDecoder) runner(c *config, t *table) []Service {
+	t.duration("interval", &c.interval)
+	t.boolean("color", &c.color)
+	t.boolean("log", &c.logWorker)
+	t.boolean("exec_notice", &c.execNotice)
+	t.boolean("exit_on_fatal", &c.exitOnFatal)
+	t.duration("shutdown_timeout", &c.shutdownTimeout)
+	t.str("control_socket", &c.controlSocket)
+	t.signal("rolling_restart_signal", &c.rollingSignal)
+	var files []string
+	t.strings("env_file", &files)
+	for _, file := range files {
+		if err := c.EnvFile(d.resolve(file)); err != nil {
+			t.fail("env_file", "%s", err)
+		}
+	}
+	var env map[string]string
+	t.stringMap("env", &env)
+	if len(env) > 0 && c.env == nil {
+		c.env = map[string]string{}
+	}
+	for k, v := range env {
+		c.env[k] = v
+	}
+	var services []Service
+	for _, st := range t.tables("services") {
+		services = append(services, st.service())
+	}
+	t.done()
+	return services
+}
+
+type table struct {
+	d    *configDecoder
+	path string
+	m    map[string]interface{}
+	used map[string]bool
+}
+
+func newTable(d *configDecoder, path string, m map[string]interface{}) *table {
+	return &table{d: d, path: path, m: m, used: map[string]bool{}}
+}
+
+func (t *table) key(key string) string {
+	if t.path == "" {
+		return key
+	}
+	return t.path + "." + key
+}
+
+func (t *table) fail(key, format string, a ...interface{}) {
+	if t.d.err == nil {
+		t.d.err = &ConfigError{Key: t.key(key), Msg: fmt.Sprintf(format, a...)}
+	}
+}
+
+func (t *table) get(key string) (interface{}, bool) {
+	v, ok := t.m[key]
+	if ok {
+		t.used[key] = true
+	}
+	return v, ok && v != nil
+}
+
+// done reports the first unknown key in the table.
+func (t *table) done() {
+	var unknown []string
+	for key := range t.m {
+		if !t.used[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		t.fail(unknown[0], "unknown key")
+	}
+}
+
+func (t *table) str(key string, dst *string) {
+	v, ok := t.get(key)
+	if !ok {
+		return
+	}
+	s, ok := v.(string)
+	if !ok {
+		t.fail(key, "must be a string, got %v", v)
+		return
+	}
+	*dst = s
+}
+
+func (t *table) boolean(key string, dst *bool) {
+	v, ok := t.get(key)
+	if !ok {
+		return
+	}
+	b, ok := v.(bool)
+	if !ok {
+		t.fail(key, "must be a boolean, got %v", v)
+		return
+	}
+	*dst = b
+}
+
+func (t *table) integer(key string, dst *int) {
+	v, ok := t.get(key)
+	if !ok {
+		return
+	}
+	switch n := v.(type) {
+	case int:
+		*dst = n
+		return
+	case int64:
+		*dst = int(n)
+		return
+	case json.Number:
+		if i, err := strconv.Atoi(n.String()); err == nil {
+			*dst = i
+			return
+		}
+	}
+	t.fail(key, "must be an integer, got %v", v)
+}
+
+func (t *table) float(key string, dst *float64) {
+	v, ok := t.get(key)
+	if !ok {
+		return
+	}
+	switch n := v.(type) {
+	case int:
+		*dst = float64(n)
+		return
+	case int64:
+		*dst = float64(n)
+		return
+	case float64:
+		*dst = n
+		return
+	case json.Number:
+		if f, err := n.Float64(); err == nil {
+			*dst = f
+			return
+		}
+	}
+	t.fail(key, "must be a number, got %v", v)
+}
+
+// duration decodes a string like "1m30s".
+func (t *table) duration(key string, dst *time.Duration) {
+	var s string
+	t.str(key, &s)
+	if s == "" {
+		return
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		t.fail(key, "invalid duration: %q", s)
+		return
+	}
+	*dst = d
+}
+
+func (t *table) signal(key string, dst *syscall.Signal) {
+	var s string
+	t.str(key, &s)
+	if s == "" {
+		return
+	}
+	sig, err := ParseSignal(s)
+	if err != nil {
+		t.fail(key, "%s", err)
+		return
+	}
+	*dst = sig
+}
+
+// strings decodes a list of strings, or a string as the list of it.
+func (t *table) strings(key string, dst *[]string) {
+	v, ok := t.get(key)
+	if !ok {
+		return
+	}
+	switch list := v.(type) {
+	case string:
+		*dst = []string{list}
+		return
+	case []interface{}:
+		ss := make([]string, 0, len(list))
+		for i, e := range list {
+			s, ok := e.(string)
+			if !ok {
+				t.fail(fmt.Sprintf("%s[%d]", key, i), "must be a string, got %v", e)
+				return
+			}
+			ss = append(ss, s)
+		}
+		*dst = ss
+		return
+	}
+	t.fail(key, "must be a list of strings, got %v", v)
+}
+
+// stringMap decodes a table of scalar values as strings.
+func (t *table) stringMap(key string, dst *map[string]string) {
+	st := t.table(key)
+	if st == nil {
+		return
+	}
+	m := map[string]string{}
+	for k, v := range st.m {
+		switch v.(type) {
+		case string, bool, int, int64, float64, json.Number:
+			m[k] = fmt.Sprint(v)
+		default:
+			st.fail(k, "must be a scalar value, got %v", v)
+			return
+		}
+	}
+	*dst = m
+}
+
+// table returns the nested table of the key, or nil if it does not exist.
+func (t *table) table(key string) *table {
+	v, ok := t.get(key)
+	if !ok {
+		return nil
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		t.fail(key, "must be a table, got %v", v)
+		return nil
+	}
+	return newTable(t.d, t.key(key), m)
+}
+
+// tables returns the list of tables of the key.
+func (t *table) tables(key string) []*table {
+	v, ok := t.get(key)
+	if !ok {
+		return nil
+	}
+	var list []map[string]interface{}
+	switch l := v.(type) {
+	case []map[string]interface{}: // array of tables in TOML
+		list = l
+	case []interface{}:
+		for i, e := range l {
+			m, ok := e.(map[string]interface{})
+			if !ok {
+				t.fail(fmt.Sprintf("%s[%d]", key, i), "must be a table, got %v", e)
+				return nil
+			}
+			list = append(list, m)
+		}
+	default:
+		t.fail(key, "must be a list of tables, got %v", v)
+		return nil
+	}
+	tables := make([]*table, 0, len(list))
+	for i, m := range list {
+		tables = append(tables, newTable(t.d, fmt.Sprintf("%s[%d]", t.key(key), i), m))
+	}
+	return tables
+}
+
+func (t *table) service() Service {
+	var s Service
+	t.str("tag", &s.Tag)
+	t.str("exec", &s.Exec)
+	if s.Exec == "" {
+		t.fail("exec", "required")
+	}
+	t.integer("worker", &s.Worker)
+	t.str("every", &s.Every)
+	t.stringMap("env", &s.Env)
+	t.strings("env_file", &s.EnvFile)
+	for i := range s.EnvFile {
+		s.EnvFile[i] = t.d.resolve(s.EnvFile[i])
+	}
+	t.str("dir", &s.Dir)
+	s.Dir = t.d.resolve(s.Dir)
+	t.strings("depends_on", &s.DependsOn)
+	t.boolean("critical", &s.Critical)
+	var restart string
+	t.str("restart", &restart)
+	if restart != "" {
+		p, err := ParseRestartPolicy(restart)
+		if err != nil {
+			t.fail("restart", "%s", err)
+		}
+		s.Restart = p
+	}
+	if bt := t.table("backoff"); bt != nil {
+		bt.duration("initial", &s.Backoff.Initial)
+		bt.duration("max", &s.Backoff.Max)
+		bt.float("multiplier", &s.Backoff.Multiplier)
+		bt.float("jitter", &s.Backoff.Jitter)
+		bt.duration("reset_after", &s.Backoff.ResetAfter)
+		bt.done()
+	}
+	t.integer("start_retries", &s.StartRetries)
+	t.duration("retry_window", &s.RetryWindow)
+	t.duration("stop_timeout", &s.StopTimeout)
+	t.signal("stop_signal", &s.StopSignal)
+	t.integer("max_unavailable", &s.MaxUnavailable)
+	if st := t.table("signals"); st != nil {
+		s.Signals = map[syscall.Signal]syscall.Signal{}
+		for name := range st.m {
+			from, err := ParseSignal(name)
+			if err != nil {
+				st.fail(name, "%s", err)
+				continue
+			}
+			var to syscall.Signal
+			st.signal(name, &to)
+			s.Signals[from] = to
+		}
+	}
+	s.Readiness = t.probe("readiness")
+	t.duration("ready_timeout", &s.ReadyTimeout)
+	s.Liveness = t.probe("liveness")
+	t.str("pre_start", &s.PreStart.Exec)
+	t.str("post_start", &s.PostStart.Exec)
+	t.str("pre_stop", &s.PreStop.Exec)
+	t.str("post_stop", &s.PostStop.Exec)
+	t.done()
+	return s
+}
+
+func (t *table) probe(key string) Probe {
+	var p Probe
+	pt := t.table(key)
+	if pt == nil {
+		return p
+	}
+	pt.boolean("tcp", &p.TCP)
+	pt.str("http", &p.HTTP)
+	pt.str("exec", &p.Exec)
+	pt.duration("interval", &p.Interval)
+	pt.duration("timeout", &p.Timeout)
+	pt.integer("failure_threshold", &p.FailureThreshold)
+	pt.done()
+	return p
+}
@@ -1,9 +1,11 @@
 package golet
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"time"
 )
 
@@ -12,6 +14,23 @@ type Context struct {
 	ctx    *signalCtx
 	logger *Logger
 	port   int
+	state  *workerState
+	env    map[string]string // environment variables of the service.
+	run    context.Context   // context of the current run. It is canceled when golet restarts the worker.
+}
+
+// withRun returns a copy of the Context for a run of the worker.
+func (c *Context) withRun(run context.Context) *Context {
+	cc := *c
+	cc.run = run
+	return &cc
+}
+
+func (c *Context) context() context.Context {
+	if c.run != nil {
+		return c.run
+	}
+	return c.ctx
 }
 
 // Port returns assgined port
@@ -24,6 +43,33 @@ func (c *Context) ServePort() string {
 	return fmt.Sprintf(":%d", c.port)
 }
 
+// Getenv returns the value of the environment variable of the service.
+// It is the same as the environment of the command, so "PORT" is the assigned port.
+func (c *Context) Getenv(key string) string {
+	v, _ := c.LookupEnv(key)
+	return v
+}
+
+// LookupEnv returns the value of the environment variable of the service, and reports whether it is present.
+// Service.Env and env files are looked up before the environment of the process.
+func (c *Context) LookupEnv(key string) (string, bool) {
+	if key == "PORT" {
+		return strconv.Itoa(c.port), true
+	}
+	if v, ok := c.env[key]; ok {
+		return v, true
+	}
+	return os.LookupEnv(key)
+}
+
+// Ready notifies golet that the service is ready.
+// Use it with Probe.Notify to start dependent services after the service is ready.
+func (c *Context) Ready() {
+	if c.state != nil {
+		c.state.markReady()
+	}
+}
+
 // Copy method is wrapped by io.Copy
 func (c *Context) Copy(src io.Reader) (written int64, err error) {
 	return io.Copy(c.logger, src)
@@ -68,20 +114,20 @@ func (c *Context) Signal() (os.Signal, error) {
 
 // Deadline is implemented for context.Context
 func (c *Context) Deadline() (deadline time.Time, ok bool) {
-	return c.ctx.Deadline()
+	return c.context().Deadline()
 }
 
 // Done is implemented for context.Context
 func (c *Context) Done() <-chan struct{} {
-	return c.ctx.Done()
+	return c.context().Done()
 }
 
 // Err is implemented for context.Context
 func (c *Context) Err() error {
-	return c.ctx.Err()
+	return c.context().Err()
 }
 
 // Value is implemented for context.Context
 func (c *Context) Value(key interface{}) interface{} {
-	return c.ctx.Value(key)
+	return c.context().Value(key)
 }
@@ -0,0 +1,400 @@
+package golet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// errNotRunning is returned by operations of the control API when golet does not run services.
+var errNotRunning = errors.New("golet is not running")
+
+// controlError is the error of the control API with the status code of the response.
+type controlError struct {
+	code int
+	msg  string
+}
+
+func (e *controlError) Error() string { return e.msg }
+
+// workers returns workers whose ID or tag is name.
+func (c *config) workers(name string) []Service {
+	var services []Service
+	for _, service := range c.serviceList() {
+		if service.id == name || service.Tag == name {
+			services = append(services, service)
+		}
+	}
+	return services
+}
+
+// waitHeld waits for the worker to be released if it is held stopped by the control API.
+// It returns false if golet starts to stop services while waiting.
+func (c *config) waitHeld(service Service) bool {
+	held := service.state.holdChan()
+	if held == nil {
+		return true
+	}
+	service.state.set(StateStopped)
+	select {
+	case <-c.ctx.Done():
+		return false
+	case <-c.stop:
+		return false
+	case <-service.state.retiredChan():
+		return false
+	case <-held:
+		return true
+	}
+}
+
+// holdWorker stops the worker, and keeps it stopped until it is started by the control API.
+func (c *config) holdWorker(service Service) {
+	done := service.state.hold()
+	if service.isCron() {
+		if done == nil && service.state.holdChan() != nil {
+			service.state.set(StateStopped)
+		}
+		return
+	}
+	if done == nil {
+		return
+	}
+	c.preStop(service)
+	if sig, ok := c.signalFor(service, syscall.SIGTERM); ok {
+		// The command may not have started yet, e.g. probes of the worker are being set up.
+		for _, p := range service.state.stopRun(sig) {
+			signalProcGroup(p, sig)
+		}
+	}
+	service.state.cancelRun()
+	c.waitStop(service, done)
+}
+
+// startWorker starts the worker which is held stopped or has finished.
+// It does nothing if the worker is running.
+func (c *config) startWorker(service Service) error {
+	if service.state.release() {
+		if service.isCron() {
+			service.state.set(StateRunning)
+		}
+		return nil
+	}
+	if service.isCron() {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.started || c.finished || c.stopping() {
+		return errNotRunning
+	}
+	if !service.state.relaunch() {
+		return nil
+	}
+	c.active++
+	if service.isCode() {
+		go c.runCallback(service)
+	} else {
+		go c.runProcess(service)
+	}
+	return nil
+}
+
+// restartByControl restarts the running worker, or starts the worker which is not running.
+func (c *config) restartByControl(service Service) error {
+	if service.isCron() || service.state.holdChan() != nil {
+		return c.startWorker(service)
+	}
+	select {
+	case <-service.state.finishedChan():
+		return c.startWorker(service)
+	default:
+	}
+	c.restartWorker(service)
+	return nil
+}
+
+// trigger runs the job of the cron service now.
+func (c *config) trigger(service Service) error {
+	if !service.isCron() {
+		return &controlError{http.StatusConflict, service.id + " is not a cron service"}
+	}
+	if service.state.holdChan() != nil {
+		return &controlError{http.StatusConflict, service.id + " is stopped"}
+	}
+	job := service.state.cronJob()
+	if job == nil {
+		return &controlError{http.StatusConflict, service.id + " is not scheduled"}
+	}
+	go job()
+	return nil
+}
+
+// serviceOf returns the first worker of the service specified by tag.
+// It returns an error of the control API if tag is not the tag of any service.
+func (c *config) serviceOf(tag string) (Service, error) {
+	for _, service := range c.workers(tag) {
+		if service.Tag == tag {
+			return service, nil
+		}
+	}
+	return Service{}, &controlError{http.StatusNotFound, "unknown service: " + tag}
+}
+
+// scale changes the number of workers of the service.
+func (c *config) scale(tag string, n int) error {
+	if _, err := c.serviceOf(tag); err != nil {
+		return err
+	}
+	if n < 1 || n > maxWorkers {
+		return &controlError{http.StatusBadRequest, fmt.Sprintf("invalid number of workers: %d (1-%d)", n, maxWorkers)}
+	}
+	return c.Scale(tag, n)
+}
+
+// rollingRestart restarts workers of the service a few at a time.
+func (c *config) rollingRestart(tag string) error {
+	service, err := c.serviceOf(tag)
+	if err != nil {
+		return err
+	}
+	if service.isCron() {
+		return &controlError{http.StatusConflict, tag + " is a cron service"}
+	}
+	return c.RollingRestart(tag)
+}
+
+// listenControl starts the control server on the unix domain socket.
+func (c *config) listenControl() error {
+	if c.controlSocket == "" {
+		return nil
+	}
+	// Remove the socket left by the previous golet, but not the one another golet still serves.
+	conn, err := net.Dial("unix", c.controlSocket)
+	switch {
+	case err == nil:
+		conn.Close()
+		return fmt.Errorf("control socket %s is already in use", c.controlSocket)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		if fi, err := os.Stat(c.controlSocket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(c.controlSocket)
+		}
+	case !errors.Is(err, syscall.ENOENT):
+		return fmt.Errorf("control socket %s is already in use: %w", c.controlSocket, err)
+	}
+	l, err := net.Listen("unix", c.controlSocket)
+	if err != nil {
+		return err
+	}
+	c.controlServer = &http.Server{Handler: c.controlHandler()}
+	go c.controlServer.Serve(l)
+	return nil
+}
+
+// closeControl stops the control server.
+func (c *config) closeControl() {
+	if c.controlServer != nil {
+		c.controlServer.Close()
+		os.Remove(c.controlSocket)
+	}
+}
+
+// controlStatus is the status of a worker in the control API.
+type controlStatus struct {
+	ID        string     `json:"id"`
+	Tag       string     `json:"tag"`
+	Kind      string     `json:"kind"`
+	State     string     `json:"state"`
+	PID       int        `json:"pid"`
+	Port      int        `json:"port"`
+	StartedAt time.Time  `json:"started_at"`
+	Restarts  int        `json:"restarts"`
+	ExitCode  int        `json:"exit_code"`
+	Error     string     `json:"error,omitempty"`
+	Next      *time.Time `json:"next,omitempty"`
+}
+
+// controlStatuses returns the status of workers whose ID or tag is name, or all workers if name is empty.
+func (c *config) controlStatuses(name string) []controlStatus {
+	statuses := []controlStatus{}
+	for _, s := range c.Status() {
+		if name != "" && s.ID != name && s.Tag != name {
+			continue
+		}
+		cs := controlStatus{
+			ID:        s.ID,
+			Tag:       s.Tag,
+			Kind:      s.Kind.String(),
+			State:     s.State.String(),
+			PID:       s.PID,
+			Port:      s.Port,
+			StartedAt: s.StartedAt,
+			Restarts:  s.Restarts,
+			ExitCode:  s.ExitCode,
+		}
+		if s.Err != nil {
+			cs.Error = s.Err.Error()
+		}
+		if !s.Next.IsZero() {
+			next := s.Next
+			cs.Next = &next
+		}
+		statuses = append(statuses, cs)
+	}
+	return statuses
+}
+
+// controlHandler returns the handler of the control API.
+//
+//	GET  /services                  list all workers
+//	POST /services/{name}/restart   restart workers
+//	POST /services/{name}/stop      stop workers, and keep them stopped
+//	POST /services/{name}/start     start stopped workers
+//	POST /services/{name}/trigger   run the cron job now
+//	POST /services/{tag}/scale      change the number of workers by {"workers": n}
+//	POST /services/{tag}/rolling-restart  restart workers a few at a time
+//	GET  /services/{name}/logs      stream logs of workers
+//	POST /reload                    reload the config file
+//
+// name is the ID of a worker like "web.0", or the tag of a service for all of its workers.
+func (c *config) controlHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/services", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeControlError(w, &controlError{http.StatusMethodNotAllowed, "method not allowed"})
+			return
+		}
+		writeControl(w, http.StatusOK, c.controlStatuses(""))
+	})
+	mux.HandleFunc("/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeControlError(w, &controlError{http.StatusMethodNotAllowed, "method not allowed"})
+			return
+		}
+		if err := c.Reload(); err != nil {
+			writeControlError(w, err)
+			return
+		}
+		writeControl(w, http.StatusOK, c.controlStatuses(""))
+	})
+	mux.HandleFunc("/services/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/services/"), "/")
+		if len(parts) != 2 || parts[0] == "" {
+			writeControlError(w, &controlError{http.StatusNotFound, "not found"})
+			return
+		}
+		name, action := parts[0], parts[1]
+		if action == "logs" && r.Method == http.MethodGet {
+			c.streamLogs(w, r, name)
+			return
+		}
+		if r.Method != http.MethodPost {
+			writeControlError(w, &controlError{http.StatusMethodNotAllowed, "method not allowed"})
+			return
+		}
+		if err := c.control(r, name, action); err != nil {
+			writeControlError(w, err)
+			return
+		}
+		writeControl(w, http.StatusOK, c.controlStatuses(name))
+	})
+	return mux
+}
+
+// control performs the action of the control API to workers whose ID or tag is name.
+func (c *config) control(r *http.Request, name, action string) error {
+	if action == "scale" {
+		var req struct {
+			Workers int `json:"workers"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return &controlError{http.StatusBadRequest, "invalid request: " + err.Error()}
+		}
+		return c.scale(name, req.Workers)
+	}
+	if action == "rolling-restart" {
+		return c.rollingRestart(name)
+	}
+	services := c.workers(name)
+	if len(services) == 0 {
+		return &controlError{http.StatusNotFound, "unknown service: " + name}
+	}
+	var op func(Service) error
+	switch action {
+	case "restart":
+		op = c.restartByControl
+	case "stop":
+		op = func(service Service) error {
+			c.holdWorker(service)
+			return nil
+		}
+	case "start":
+		op = c.startWorker
+	case "trigger":
+		op = c.trigger
+	default:
+		return &controlError{http.StatusNotFound, "unknown action: " + action}
+	}
+	for _, service := range services {
+		if err := op(service); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamLogs writes logs of workers whose ID or tag is name until the client disconnects.
+func (c *config) streamLogs(w http.ResponseWriter, r *http.Request, name string) {
+	if len(c.workers(name)) == 0 {
+		writeControlError(w, &controlError{http.StatusNotFound, "unknown service: " + name})
+		return
+	}
+	ch := c.logTap.subscribe(name)
+	defer c.logTap.unsubscribe(ch)
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	for {
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case line := <-ch:
+			if _, err := w.Write(line); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func writeControl(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeControlError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if errors.Is(err, errNotRunning) || errors.Is(err, errNoConfig) {
+		code = http.StatusConflict
+	}
+	var cfgErr *ConfigError
+	if errors.As(err, &cfgErr) {
+		code = http.StatusBadRequest
+	}
+	var cerr *controlError
+	if errors.As(err, &cerr) {
+		code = cerr.code
+	}
+	writeControl(w, code, map[string]string{"error": fmt.Sprint(err)})
+}
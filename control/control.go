@@ -0,0 +1,176 @@
+// Package control is a client of the control API of golet.
+//
+// The control API is served on the unix domain socket specified by Runner.SetControlSocket.
+//
+//	c := control.New("/tmp/golet.sock")
+//	services, err := c.Services(context.Background())
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Service is the status of a worker.
+type Service struct {
+	ID        string     `json:"id"`         // ID of the worker like "tag.0".
+	Tag       string     `json:"tag"`        // Tag of the service.
+	Kind      string     `json:"kind"`       // "exec", "code" or "cron".
+	State     string     `json:"state"`      // "STARTING", "RUNNING", "BACKOFF", "STOPPED" or "FATAL".
+	PID       int        `json:"pid"`        // Process ID of the running command. 0 if it is not running.
+	Port      int        `json:"port"`       // Assigned port.
+	StartedAt time.Time  `json:"started_at"` // Time the current or last run started.
+	Restarts  int        `json:"restarts"`   // Number of restarts.
+	ExitCode  int        `json:"exit_code"`  // Exit code of the last run of the command.
+	Error     string     `json:"error"`      // Error of the last run.
+	Next      *time.Time `json:"next"`       // Next scheduled run of the cron service.
+}
+
+// Error is the error returned by the control API.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("golet: %s (%d)", e.Message, e.StatusCode)
+}
+
+// Client is a client of the control API.
+type Client struct {
+	client *http.Client
+}
+
+// New creates a client of the control API served on the unix domain socket at path.
+func New(path string) *Client {
+	return &Client{
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", path)
+				},
+			},
+		},
+	}
+}
+
+// Services returns the status of all workers.
+func (c *Client) Services(ctx context.Context) ([]Service, error) {
+	return c.do(ctx, http.MethodGet, "/services", nil)
+}
+
+// Restart restarts the worker specified by ID like "web.0", or all workers of the tag.
+// Workers which are not running are started.
+func (c *Client) Restart(ctx context.Context, name string) ([]Service, error) {
+	return c.action(ctx, name, "restart", nil)
+}
+
+// Stop stops the worker specified by ID, or all workers of the tag.
+// They are not restarted until Start or Restart is called.
+func (c *Client) Stop(ctx context.Context, name string) ([]Service, error) {
+	return c.action(ctx, name, "stop", nil)
+}
+
+// Start starts the stopped worker specified by ID, or all workers of the tag.
+func (c *Client) Start(ctx context.Context, name string) ([]Service, error) {
+	return c.action(ctx, name, "start", nil)
+}
+
+// Trigger runs the job of the cron service now.
+func (c *Client) Trigger(ctx context.Context, name string) ([]Service, error) {
+	return c.action(ctx, name, "trigger", nil)
+}
+
+// Scale changes the number of workers of the service specified by tag.
+func (c *Client) Scale(ctx context.Context, tag string, workers int) ([]Service, error) {
+	return c.action(ctx, tag, "scale", map[string]int{"workers": workers})
+}
+
+// Reload makes golet reload services from its config file, and returns the status of all workers.
+func (c *Client) Reload(ctx context.Context) ([]Service, error) {
+	return c.do(ctx, http.MethodPost, "/reload", nil)
+}
+
+// RollingRestart restarts workers of the service specified by tag a few at a time.
+// It returns after all workers are restarted and ready.
+func (c *Client) RollingRestart(ctx context.Context, tag string) ([]Service, error) {
+	return c.action(ctx, tag, "rolling-restart", nil)
+}
+
+// Logs writes logs of the worker specified by ID, or all workers of the tag to w.
+// It blocks until ctx is done or golet finishes.
+func (c *Client) Logs(ctx context.Context, name string, w io.Writer) error {
+	req, err := http.NewRequest(http.MethodGet, "http://golet/services/"+url.PathEscape(name)+"/logs", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	_, err = io.Copy(w, resp.Body)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func (c *Client) action(ctx context.Context, name, action string, body interface{}) ([]Service, error) {
+	return c.do(ctx, http.MethodPost, "/services/"+url.PathEscape(name)+"/"+action, body)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body interface{}) ([]Service, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+	// The host is ignored because the client always connects to the socket.
+	req, err := http.NewRequest(method, "http://golet"+path, r)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	var services []Service
+	if err := json.NewDecoder(resp.Body).Decode(&services); err != nil {
+		return nil, err
+	}
+	return services, nil
+}
+
+// responseError returns the error of the response from the control API.
+func responseError(resp *http.Response) error {
+	var e struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+		e.Error = http.StatusText(resp.StatusCode)
+	}
+	return &Error{StatusCode: resp.StatusCode, Message: e.Error}
+}
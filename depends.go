@@ -0,0 +1,97 @@
+package golet
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dependencyOrder returns tags of services in the order to start them.
+// A tag comes after all tags it depends on, otherwise the order of services is kept.
+// If strict is true, it returns an error when a service depends on an unknown tag.
+func dependencyOrder(services []Service, strict bool) ([]string, error) {
+	tags := make([]string, 0, len(services))
+	deps := map[string][]string{}
+	for _, s := range services {
+		if _, ok := deps[s.Tag]; !ok {
+			tags = append(tags, s.Tag)
+			deps[s.Tag] = append([]string{}, s.DependsOn...)
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := map[string]int{}
+	order := make([]string, 0, len(tags))
+	var visit func(tag string, path []string) error
+	visit = func(tag string, path []string) error {
+		switch marks[tag] {
+		case visited:
+			return nil
+		case visiting:
+			for i, t := range path {
+				if t == tag {
+					path = path[i:]
+					break
+				}
+			}
+			return fmt.Errorf("dependency cycle: %s", strings.Join(append(path, tag), " -> "))
+		}
+		marks[tag] = visiting
+		for _, dep := range deps[tag] {
+			if _, ok := deps[dep]; !ok {
+				if strict {
+					return fmt.Errorf("tag: %s depends on unknown tag: %s", tag, dep)
+				}
+				continue
+			}
+			if err := visit(dep, append(path, tag)); err != nil {
+				return err
+			}
+		}
+		marks[tag] = visited
+		order = append(order, tag)
+		return nil
+	}
+	for _, tag := range tags {
+		if err := visit(tag, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// sortServices sorts services in the order of dependencies.
+func sortServices(services []Service) ([]Service, error) {
+	order, err := dependencyOrder(services, true)
+	if err != nil {
+		return nil, err
+	}
+	sorted := make([]Service, 0, len(services))
+	for _, tag := range order {
+		for _, s := range services {
+			if s.Tag == tag {
+				sorted = append(sorted, s)
+			}
+		}
+	}
+	return sorted, nil
+}
+
+// dependents returns the map of tags to the tags which depend on them.
+func dependents(services []Service) map[string][]string {
+	m := map[string][]string{}
+	seen := map[string]bool{}
+	for _, s := range services {
+		if seen[s.Tag] {
+			continue
+		}
+		seen[s.Tag] = true
+		for _, dep := range s.DependsOn {
+			m[dep] = append(m[dep], s.Tag)
+		}
+	}
+	return m
+}
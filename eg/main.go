@@ -51,8 +51,9 @@ func main() {
 
 	// You can comment out this
 	p.Add(golet.Service{
-		Code:   serveCode(),
-		Worker: 3,
+		Code:    serveCode(),
+		Worker:  3,
+		Restart: golet.RestartAlways,
 	})
 
 	p.Run()
@@ -95,7 +96,7 @@ func serveCode() func(context.Context) error {
 					return err
 				}
 				switch signal {
-				// If you send TERM or HUP, restart this callback immediately
+				// If you send TERM or HUP, golet stops all services. This callback is not restarted
 				case syscall.SIGTERM, syscall.SIGHUP:
 					c.Println(signal.String())
 					if err := srv.Shutdown(ctx); err != nil {
@@ -0,0 +1,163 @@
+package golet
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	envKey      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+	envVariable = regexp.MustCompile(`\\?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+)
+
+// EnvFile loads dotenv files as environment variables of all services.
+// Unlike Env, it does not change the environment of the process. Call it before Add.
+func (c *config) EnvFile(paths ...string) error {
+	if c.env == nil {
+		c.env = map[string]string{}
+	}
+	for _, path := range paths {
+		if err := loadEnvFile(path, c.env, os.LookupEnv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serviceEnv returns environment variables of the service merged with ones of golet.
+// The priority is Service.Env, Service.EnvFile and EnvFile in descending order.
+func (c *config) serviceEnv(service Service) (map[string]string, error) {
+	env := map[string]string{}
+	for k, v := range c.env {
+		env[k] = v
+	}
+	for _, path := range service.EnvFile {
+		if err := loadEnvFile(path, env, os.LookupEnv); err != nil {
+			return nil, err
+		}
+	}
+	for k, v := range service.Env {
+		env[k] = v
+	}
+	return env, nil
+}
+
+// environ returns environment variables in the form of "key=value" sorted by key.
+func environ(env map[string]string) []string {
+	list := make([]string, 0, len(env))
+	for k, v := range env {
+		list = append(list, k+"="+v)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func loadEnvFile(path string, env map[string]string, lookup func(string) (string, bool)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := parseEnv(f, env, lookup); err != nil {
+		return fmt.Errorf("%s:%s", path, err)
+	}
+	return nil
+}
+
+// parseEnv parses dotenv format into env.
+//
+//	# comment
+//	export KEY=value
+//	KEY="double quoted\n${OTHER}"
+//	KEY='single quoted ${NOT_EXPANDED}'
+//	KEY=unquoted ${OTHER} # comment
+//
+// "${VAR}" is replaced with the variable defined above or found by lookup.
+// It is not replaced in single quotes, or if it is escaped like "\${VAR}".
+func parseEnv(r io.Reader, env map[string]string, lookup func(string) (string, bool)) error {
+	expand := func(s string) string {
+		return envVariable.ReplaceAllStringFunc(s, func(m string) string {
+			if m[0] == '\\' {
+				return m[1:]
+			}
+			key := m[2 : len(m)-1]
+			if v, ok := env[key]; ok {
+				return v
+			}
+			v, _ := lookup(key)
+			return v
+		})
+	}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return fmt.Errorf("%d: missing '=': %q", n, line)
+		}
+		key, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		if !envKey.MatchString(key) {
+			return fmt.Errorf("%d: invalid key: %q", n, key)
+		}
+		switch {
+		case strings.HasPrefix(value, "'"):
+			end := strings.Index(value[1:], "'")
+			if end < 0 {
+				return fmt.Errorf("%d: unterminated single quote", n)
+			}
+			value = value[1 : end+1]
+		case strings.HasPrefix(value, `"`):
+			v, ok := unquoteEnv(value[1:])
+			if !ok {
+				return fmt.Errorf("%d: unterminated double quote", n)
+			}
+			value = strings.Replace(expand(v), `\$`, "$", -1)
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+			value = expand(value)
+		}
+		env[key] = value
+	}
+	return s.Err()
+}
+
+// unquoteEnv returns the value until the closing double quote with escape sequences replaced.
+// "\$" is kept to prevent the expansion of variables.
+func unquoteEnv(s string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), true
+		case '\\':
+			if i+1 == len(s) {
+				return "", false
+			}
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case '$':
+				b.WriteString(`\$`)
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,131 @@
+package golet
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// ServiceError describes a worker which failed.
+type ServiceError struct {
+	ID       string         // ID of the worker like "tag.0".
+	State    State          // Final state of the worker.
+	ExitCode int            // Exit code of the command. -1 if the command did not exit normally or the service is a callback.
+	Signal   syscall.Signal // Signal which terminated the command. 0 if it was not terminated by a signal.
+	Err      error          // Error of the command or the callback.
+}
+
+func (e *ServiceError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%s (%s)", e.ID, e.State)
+	}
+	return fmt.Sprintf("%s (%s): %s", e.ID, e.State, e.Err.Error())
+}
+
+// Unwrap returns the error of the command or the callback.
+func (e *ServiceError) Unwrap() error { return e.Err }
+
+// RunError is returned by Run and Wait when golet stopped all services
+// because of something wrong, or some services failed.
+type RunError struct {
+	Reason   error           // Why golet stopped all services. nil if golet stopped them as usual.
+	Signal   os.Signal       // Signal golet received to stop services. nil if golet did not receive any signal.
+	Services []*ServiceError // Workers which failed.
+}
+
+func (e *RunError) Error() string {
+	msgs := make([]string, 0, len(e.Services)+1)
+	if e.Reason != nil {
+		msgs = append(msgs, e.Reason.Error())
+	}
+	for _, s := range e.Services {
+		msgs = append(msgs, s.Error())
+	}
+	return "golet: " + strings.Join(msgs, "; ")
+}
+
+// ExitCode returns the exit code for the process of golet.
+// If golet stopped services because a critical service finished, it returns the exit code of that service.
+// The exit code of the command terminated by a signal is 128 + the signal number like shells.
+func (e *RunError) ExitCode() int {
+	if s, ok := e.Reason.(*ServiceError); ok {
+		return s.exitCode()
+	}
+	for _, s := range e.Services {
+		if code := s.exitCode(); code > 1 {
+			return code
+		}
+	}
+	return 1
+}
+
+func (e *ServiceError) exitCode() int {
+	switch {
+	case e.Err == nil:
+		return 0
+	case e.Signal != 0:
+		return 128 + int(e.Signal)
+	case e.ExitCode > 0:
+		return e.ExitCode
+	}
+	return 1
+}
+
+// Unwrap returns the reason and errors of the workers.
+func (e *RunError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Services)+1)
+	if e.Reason != nil {
+		errs = append(errs, e.Reason)
+	}
+	for _, s := range e.Services {
+		errs = append(errs, s)
+	}
+	return errs
+}
+
+// exitStatus returns the exit code and the signal which terminated the command from the error of it.
+func exitStatus(err error) (int, syscall.Signal) {
+	if err == nil {
+		return 0, 0
+	}
+	var exiterr *exec.ExitError
+	if errors.As(err, &exiterr) {
+		// See https://stackoverflow.com/a/10385867
+		if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+			if status.Signaled() {
+				return -1, status.Signal()
+			}
+			return status.ExitStatus(), 0
+		}
+	}
+	return -1, 0
+}
+
+// runError returns the error which describes why golet stopped services.
+// It returns nil if nothing went wrong.
+func (c *config) runError() error {
+	c.mu.Lock()
+	reason, sig := c.err, c.stopSignal
+	c.mu.Unlock()
+	var failed []*ServiceError
+	for _, service := range c.serviceList() {
+		// The critical service is already the reason.
+		if s, ok := reason.(*ServiceError); ok && s.ID == service.id {
+			continue
+		}
+		if e := service.state.failure(service.id); e != nil {
+			failed = append(failed, e)
+		}
+	}
+	if reason == nil && len(failed) == 0 {
+		return nil
+	}
+	return &RunError{
+		Reason:   reason,
+		Signal:   sig,
+		Services: failed,
+	}
+}
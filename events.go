@@ -0,0 +1,156 @@
+package golet
+
+import (
+	"os"
+	"time"
+)
+
+// eventBuffer is the buffer size of each event channel.
+// Events are dropped while the buffer of the subscriber is full.
+const eventBuffer = 128
+
+// EventType represents the type of a lifecycle event.
+type EventType int
+
+const (
+	// ServiceStarting is emitted when golet starts a run of the worker.
+	// For cron services, it is emitted when the service is added to cron.
+	ServiceStarting EventType = iota
+	// ServiceStarted is emitted when the command started or the callback is called.
+	ServiceStarted
+	// ServiceExited is emitted when the command exited or the callback returned.
+	ServiceExited
+	// ServiceRestarting is emitted when golet waits to restart the worker.
+	ServiceRestarting
+	// CronFired is emitted when cron runs the cron service.
+	CronFired
+	// SignalReceived is emitted when golet received a signal.
+	SignalReceived
+	// ShutdownBegun is emitted when golet started to stop all services.
+	ShutdownBegun
+)
+
+// String returns the name of the event type.
+func (t EventType) String() string {
+	switch t {
+	case ServiceStarting:
+		return "starting"
+	case ServiceStarted:
+		return "started"
+	case ServiceExited:
+		return "exited"
+	case ServiceRestarting:
+		return "restarting"
+	case CronFired:
+		return "cron-fired"
+	case SignalReceived:
+		return "signal"
+	case ShutdownBegun:
+		return "shutdown"
+	}
+	return "unknown"
+}
+
+// Event is a lifecycle event of golet.
+type Event struct {
+	Type     EventType
+	Time     time.Time
+	ID       string        // ID of the worker like "tag.0". Empty for SignalReceived and ShutdownBegun.
+	Tag      string        // Tag of the service.
+	PID      int           // Process ID of the command for ServiceStarted and ServiceExited.
+	ExitCode int           // Exit code for ServiceExited. -1 if the command did not exit normally.
+	Signal   os.Signal     // Signal which terminated the command, or signal golet received. nil if golet did not receive any.
+	Err      error         // Error of the run for ServiceExited.
+	Delay    time.Duration // Delay before restart for ServiceRestarting.
+}
+
+// Events returns a channel to receive lifecycle events.
+// Each call returns a new channel, and it is closed after all services finished.
+// Events are dropped if the receiver does not keep up with them.
+func (c *config) Events() <-chan Event {
+	ch := make(chan Event, eventBuffer)
+	c.evMu.Lock()
+	defer c.evMu.Unlock()
+	if c.evClosed {
+		close(ch)
+		return ch
+	}
+	c.subscribers = append(c.subscribers, ch)
+	return ch
+}
+
+// emit sends the event to all subscribers.
+func (c *config) emit(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	c.evMu.Lock()
+	defer c.evMu.Unlock()
+	if c.evClosed {
+		return
+	}
+	for _, ch := range c.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// emitService sends the event of the worker, and logs the notice of it.
+func (c *config) emitService(service Service, e Event) {
+	e.Time = time.Now()
+	e.ID = service.id
+	e.Tag = service.Tag
+	c.logEvent(service, e)
+	c.emit(e)
+}
+
+// logEvent writes the notice of the event to the log of the worker.
+func (c *config) logEvent(service Service, e Event) {
+	switch e.Type {
+	case ServiceStarting:
+		// Notify you have executed the command or run the callback
+		if !c.execNotice {
+			return
+		}
+		if service.isCode() {
+			service.ctx.Printf("Callback: %s\n", service.Tag)
+		} else {
+			service.ctx.Printf("Exec command: %s\n", service.Exec)
+		}
+	case ServiceExited:
+		if service.isCode() && e.Err != nil {
+			service.ctx.Printf("Callback Error: %s\n", e.Err.Error())
+		}
+	case ServiceRestarting:
+		if c.execNotice {
+			service.ctx.Printf("Restart in %s\n", e.Delay)
+		}
+	}
+}
+
+// exitEvent returns ServiceExited event of the result of the run.
+func exitEvent(pid int, err error) Event {
+	e := Event{Type: ServiceExited, PID: pid, Err: err}
+	code, sig := exitStatus(err)
+	e.ExitCode = code
+	if sig != 0 {
+		e.Signal = sig
+	}
+	return e
+}
+
+// closeEvents closes all event channels.
+func (c *config) closeEvents() {
+	c.evMu.Lock()
+	defer c.evMu.Unlock()
+	if c.evClosed {
+		return
+	}
+	c.evClosed = true
+	for _, ch := range c.subscribers {
+		close(ch)
+	}
+	c.subscribers = nil
+}
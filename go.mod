@@ -0,0 +1,18 @@
+module github.com/Code-Hex/golet
+
+go 1.20
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/mattn/go-colorable v0.1.15
+	github.com/robfig/cron v1.2.0
+	github.com/stretchr/testify v1.9.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+)
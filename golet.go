@@ -5,10 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"runtime"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -41,13 +43,43 @@ type config struct {
 	logWorker    bool           // enable worker for format logs. If disabled this option, cannot use logger opt too.
 	execNotice   bool           // enable start and exec notice message like: `16:38:12 worker.1 | Start callback: worker``.
 	cancelSignal syscall.Signal // sets the syscall.Signal to notify context cancel. If you sets something, you can send that signal to processes when context cancel.
+	exitOnFatal  bool           // stop all services when a service entered FATAL state.
+
+	shutdownTimeout time.Duration     // deadline to wait for all services to finish after golet started to stop them.
+	env             map[string]string // environment variables of all services loaded by EnvFile.
+	controlSocket   string            // path of the unix domain socket for the control API.
+	rollingSignal   syscall.Signal    // signal to restart all services by RollingRestart. 0 if not set.
 
 	services   []Service
-	wg         sync.WaitGroup
+	servicesMu sync.RWMutex // guards services after golet started, because Reload changes them.
+	active     int          // number of running workers and changes of services which keep golet running. guarded by mu.
+	idle       *sync.Cond   // broadcasted when active becomes 0.
+	finished   bool         // whether golet finished waiting for active to become 0. guarded by mu.
 	ctx        *signalCtx
 	serviceNum int
 	tags       map[string]struct{}
 	cron       *cron.Cron
+	cronMu     sync.Mutex
+	cronActive bool // whether cron is started.
+	mu         sync.Mutex
+	err        error         // the reason why golet stopped all services.
+	stopSignal os.Signal     // the signal golet received to stop all services. nil if it did not receive any.
+	stop       chan struct{} // closed when golet starts to stop all services.
+	stopOnce   sync.Once
+	started    bool
+	done       chan struct{} // closed when all services finished.
+	launched   chan struct{} // closed when golet launched all services added before Start.
+
+	configPath string          // path of the config file loaded by LoadConfig.
+	configTags map[string]bool // tags of services defined in the config file.
+	changeMu   sync.Mutex      // serializes changes of services while golet is running.
+
+	subscribers []chan Event
+	evMu        sync.Mutex
+	evClosed    bool
+
+	controlServer *http.Server
+	logTap        logTap
 }
 
 var shell []string
@@ -76,9 +108,25 @@ type Runner interface {
 	DisableLogger()
 	DisableExecNotice()
 	SetCtxCancelSignal(syscall.Signal)
+	EnableExitOnFatal()
+	SetShutdownTimeout(time.Duration)
+	SetControlSocket(string)
+	ControlSocket() string
+	SetRollingRestartSignal(syscall.Signal)
 	Env(map[string]string) error
+	EnvFile(...string) error
 	Add(...Service) error
+	Remove(tag string) error
+	Scale(tag string, n int) error
+	RollingRestart(tag string) error
 	Run() error
+	Start() error
+	Stop(context.Context) error
+	Wait() error
+	State(id string) (State, bool)
+	Status() []ServiceStatus
+	Events() <-chan Event
+	Reload() error
 }
 
 // for settings
@@ -112,11 +160,27 @@ func (c *config) DisableExecNotice() { c.execNotice = false }
 // If you do not set, golet will not send the signal when context cancel.
 func (c *config) SetCtxCancelSignal(signal syscall.Signal) { c.cancelSignal = signal }
 
+// EnableExitOnFatal can stop all services when a service entered FATAL state.
+// In that case, Run returns an error.
+func (c *config) EnableExitOnFatal() { c.exitOnFatal = true }
+
+// SetShutdownTimeout can specify the deadline to wait for all services to finish after golet started to stop them.
+// When the deadline exceeded, golet sends SIGKILL to all processes and Run returns an error.
+// If you do not set, golet waits for services until they finish.
+func (c *config) SetShutdownTimeout(t time.Duration) { c.shutdownTimeout = t }
+
+// SetControlSocket can specify the path of the unix domain socket to serve the control API.
+// If you do not set, golet does not serve it. See also github.com/Code-Hex/golet/control.
+func (c *config) SetControlSocket(path string) { c.controlSocket = path }
+
+// ControlSocket returns the path of the unix domain socket to serve the control API. Empty if it is not set.
+func (c *config) ControlSocket() string { return c.controlSocket }
+
 // New to create struct of golet.
 func New(ctx context.Context) Runner {
 	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT)
-	return &config{
+	signal.Notify(signals, trapSignals...)
+	c := &config{
 		interval:     0,
 		color:        false,
 		logger:       colorable.NewColorableStderr(),
@@ -128,12 +192,19 @@ func New(ctx context.Context) Runner {
 			parent:  ctx,
 			sigchan: signals,
 		},
-		tags: map[string]struct{}{},
-		cron: cron.New(),
+		tags:     map[string]struct{}{},
+		cron:     cron.New(),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		launched: make(chan struct{}),
 	}
+	c.idle = sync.NewCond(&c.mu)
+	return c
 }
 
 // Env can add temporary environment variables.
+// They are set to the environment of the process, so the host program sees them too.
+// Use EnvFile or Service.Env to set variables only to services.
 func (c *config) Env(envs map[string]string) error {
 	for k := range envs {
 		if e := os.Setenv(k, envs[k]); e != nil {
@@ -144,102 +215,364 @@ func (c *config) Env(envs map[string]string) error {
 }
 
 // Add can add runnable services
+// After golet started, services are launched immediately. Their dependencies must have been added.
+// If some services are invalid, it returns ValidationErrors and adds none of them. See Service.Validate.
 func (c *config) Add(services ...Service) error {
+	if err := validate(services); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	started := c.started
+	c.mu.Unlock()
+	if started {
+		return c.addRunning(services)
+	}
 	for _, service := range services {
-		c.serviceNum++
-		if service.Tag == "" {
-			service.Tag = fmt.Sprintf("%d", c.serviceNum)
-		}
-		if service.Worker <= 0 {
-			service.Worker = 1
+		env, err := c.define(&service)
+		if err != nil {
+			return err
 		}
-		if _, ok := c.tags[service.Tag]; ok {
-			return errors.New("tag: " + service.Tag + " is already exists")
+		// Dependencies may be added later, so only check cycles here.
+		if _, err := dependencyOrder(append(c.services[:len(c.services):len(c.services)], service), false); err != nil {
+			return err
 		}
 		c.tags[service.Tag] = struct{}{}
 
-		n, err := port.GetPort()
+		workers, err := c.newWorkers(service, env)
 		if err != nil {
 			return err
 		}
-		for i := 0; i < service.Worker; i++ {
-			service.id = fmt.Sprintf("%s.%d", service.Tag, i)
-			service.ctx = &Context{
-				ctx:  c.ctx,
-				port: n + i,
-				logger: &Logger{
-					enable:      c.logWorker,
-					enableColor: c.color,
-					out:         c.logger,
-					sid:         service.id,
-					clr:         color(c.serviceNum%colornum + 32),
-				},
-			}
-			c.services = append(c.services, service)
+		c.services = append(c.services, workers...)
+	}
+	return nil
+}
+
+// addRunning adds services to the running golet, and launches them in order of dependencies.
+func (c *config) addRunning(services []Service) error {
+	c.changeMu.Lock()
+	defer c.changeMu.Unlock()
+	if err := c.holdRunning(); err != nil {
+		return err
+	}
+	defer c.leave()
+
+	list := append([]Service{}, c.serviceList()...)
+	var workers []Service
+	fresh := map[string]bool{}
+	for _, service := range services {
+		if fresh[service.Tag] {
+			releasePorts(workers, true)
+			return errors.New("tag: " + service.Tag + " is already exists")
+		}
+		env, err := c.define(&service)
+		if err == nil {
+			var w []Service
+			w, err = c.newWorkers(service, env)
+			workers = append(workers, w...)
+		}
+		if err != nil {
+			releasePorts(workers, true)
+			return err
+		}
+		fresh[service.Tag] = true
+	}
+	sorted, err := sortServices(append(list, workers...))
+	if err != nil {
+		releasePorts(workers, true)
+		return err
+	}
+	for tag := range fresh {
+		c.tags[tag] = struct{}{}
+	}
+	c.apply(sorted, nil, workers)
+	return nil
+}
+
+// Remove stops all workers of the service specified by tag gracefully, and removes the service.
+// The tag and ports of the service can be used by services added later.
+// It returns an error if other services depend on the service.
+func (c *config) Remove(tag string) error {
+	c.mu.Lock()
+	started := c.started
+	c.mu.Unlock()
+	if started {
+		c.changeMu.Lock()
+		defer c.changeMu.Unlock()
+		if err := c.holdRunning(); err != nil {
+			return err
+		}
+		defer c.leave()
+	}
+	var kept, removed []Service
+	for _, service := range c.serviceList() {
+		if service.Tag == tag {
+			removed = append(removed, service)
+		} else {
+			kept = append(kept, service)
 		}
 	}
+	if len(removed) == 0 {
+		return errors.New("tag: " + tag + " does not exist")
+	}
+	if deps := dependents(kept)[tag]; len(deps) > 0 {
+		return fmt.Errorf("tag: %s is depended on by %s", tag, strings.Join(deps, ", "))
+	}
+	if started {
+		c.apply(kept, removed, nil)
+	} else {
+		c.servicesMu.Lock()
+		c.services = kept
+		c.servicesMu.Unlock()
+	}
+	releasePorts(removed, true)
+	delete(c.tags, tag)
+	delete(c.configTags, tag)
 	return nil
 }
 
+// define sets defaults of the service, and returns its environment variables.
+func (c *config) define(service *Service) (map[string]string, error) {
+	c.serviceNum++
+	if service.Tag == "" {
+		service.Tag = fmt.Sprintf("%d", c.serviceNum)
+	}
+	if service.Worker <= 0 {
+		service.Worker = 1
+	}
+	if _, ok := c.tags[service.Tag]; ok {
+		return nil, errors.New("tag: " + service.Tag + " is already exists")
+	}
+	return c.serviceEnv(*service)
+}
+
+// newWorkers creates workers of the service with assigned ports.
+func (c *config) newWorkers(service Service, env map[string]string) ([]Service, error) {
+	n, err := port.GetPort()
+	if err != nil {
+		return nil, err
+	}
+	service.basePort = n
+	workers := make([]Service, 0, service.Worker)
+	for i := 0; i < service.Worker; i++ {
+		workers = append(workers, c.newWorker(service, env, i, n+i, color(c.serviceNum%colornum+32)))
+	}
+	return workers, nil
+}
+
+// newWorker creates the i-th worker of the service.
+func (c *config) newWorker(service Service, env map[string]string, i, port int, clr color) Service {
+	service.id = fmt.Sprintf("%s.%d", service.Tag, i)
+	service.state = newWorkerState()
+	service.ctx = &Context{
+		ctx:   c.ctx,
+		port:  port,
+		state: service.state,
+		env:   env,
+		logger: &Logger{
+			enable:      c.logWorker,
+			enableColor: c.color,
+			out:         c.logger,
+			sid:         service.id,
+			tag:         service.Tag,
+			clr:         clr,
+			tap:         &c.logTap,
+		},
+	}
+	return service
+}
+
+// releasePorts releases ports of the workers to be reused.
+// Each service has the block of maxWorkers ports from its base port, and ports out of it are released one by one.
+// The base port is released only if whole is true, because it stands for the block used by the rest of workers.
+func releasePorts(workers []Service, whole bool) {
+	seen := map[int]bool{}
+	for _, w := range workers {
+		if p := w.ctx.Port(); p < w.basePort || p >= w.basePort+maxWorkers {
+			port.Release(p)
+		}
+		if whole && !seen[w.basePort] {
+			seen[w.basePort] = true
+			port.Release(w.basePort)
+		}
+	}
+}
+
+// serviceList returns workers of all services.
+// The returned slice is not changed by Reload, because it replaces the slice.
+func (c *config) serviceList() []Service {
+	c.servicesMu.RLock()
+	defer c.servicesMu.RUnlock()
+	return c.services
+}
+
 // Run just like the name.
 func (c *config) Run() error {
-	chps := make(chan *os.Process, 1)
-	go c.waitSignals(chps, len(c.services))
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+// Start runs services without blocking.
+func (c *config) Start() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.started {
+		return errors.New("golet is already started")
+	}
+	services, err := sortServices(c.services)
+	if err != nil {
+		return err
+	}
+	c.servicesMu.Lock()
+	c.services = services
+	c.servicesMu.Unlock()
+	// Options of the logger may be set after Add, like services loaded by LoadConfig.
+	for _, service := range services {
+		l := service.ctx.logger
+		l.enable, l.enableColor, l.out = c.logWorker, c.color, c.logger
+	}
+	if err := c.listenControl(); err != nil {
+		return err
+	}
+	c.started = true
+
+	go c.waitSignals()
+	go c.run()
+	return nil
+}
+
+// Wait waits for all services to finish, and returns the reason why golet stopped them.
+func (c *config) Wait() error {
+	c.mu.Lock()
+	started := c.started
+	c.mu.Unlock()
+	if !started {
+		return errors.New("golet is not started")
+	}
+	<-c.done
+	return c.runError()
+}
+
+// Stop stops all services gracefully in reverse order of dependencies, and waits for them to finish.
+// Services are sent their stop signal in the same way as SIGTERM, though RunError.Signal is nil.
+// If ctx is done before they finish, golet sends SIGKILL to all processes and returns ctx.Err().
+func (c *config) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	started := c.started
+	c.mu.Unlock()
+	if !started {
+		c.shutdown(nil, nil)
+		return nil
+	}
+	c.shutdown(nil, syscall.SIGTERM)
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		c.killAll()
+		return ctx.Err()
+	}
+}
+
+// run invokes services, and waits for them to finish.
+func (c *config) run() {
+	defer close(c.done)
 
 	// Invoke workers.
 	for _, service := range c.services {
-		// Run one for each service.
-		if service.isExecute() {
-			c.executeRun(service, chps)
-		} else if service.isCode() {
-			c.executeCallback(service)
+		if c.stopping() {
+			break
 		}
-		// When the task is cron, it does not cause wait time.
-		if service.Every == "" {
+		c.launch(service)
+	}
+	close(c.launched)
+
+	c.wait()
+	c.closeControl()
+	c.closeEvents()
+}
+
+// launch runs the worker, and waits for it to be ready or the interval.
+func (c *config) launch(service Service) {
+	// Run one for each service.
+	if service.isExecute() {
+		c.executeRun(service)
+	} else if service.isCode() {
+		c.executeCallback(service)
+	}
+	// When the task is cron, it does not cause wait time.
+	if service.Every == "" {
+		// Wait for the service to be ready instead of the interval.
+		// So that dependent services start after it is ready.
+		if service.Readiness.enabled() {
+			c.waitReady(service)
+		} else {
 			time.Sleep(c.interval)
 		}
 	}
+}
 
-	c.wait(chps)
-
-	return nil
+// State returns the state of the worker specified by id like "tag.0".
+func (c *config) State(id string) (State, bool) {
+	for _, service := range c.serviceList() {
+		if service.id == id {
+			return service.state.get(), true
+		}
+	}
+	return StateStopped, false
 }
 
 // executeRun run command as a process
-func (c *config) executeRun(service Service, chps chan<- *os.Process) {
+func (c *config) executeRun(service Service) {
 	// Execute the command with cron or goroutine
 	if service.isCron() {
-		c.addCmd(service, chps)
+		c.addCmd(service)
 	} else {
-		c.wg.Add(1)
-		go func() {
-			defer c.wg.Done()
-		PROCESS:
-			for {
-				// Notify you have executed the command
-				if c.execNotice {
-					service.ctx.Printf("Exec command: %s\n", service.Exec)
-				}
-				select {
-				case <-c.ctx.Done():
-					return
-				default:
-					// If golet is received signal or exit code is 0, golet do not restart process.
-					if err := run(service.prepare(), chps); err != nil {
-						if exiterr, ok := err.(*exec.ExitError); ok {
-							// See https://stackoverflow.com/a/10385867
-							if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-								if !status.Signaled() {
-									continue PROCESS
-								}
-								return
-							}
-						}
-					}
-					return
-				}
+		c.enter()
+		go c.runProcess(service)
+	}
+}
+
+// runProcess runs the command of the worker, and restarts it by the restart policy.
+func (c *config) runProcess(service Service) {
+	defer c.leave()
+	defer c.exited(service)
+	bo := newBackoff(service.Backoff)
+PROCESS:
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-c.stop:
+			return
+		default:
+			if !c.waitHeld(service) {
+				return
+			}
+			// Whether to restart the process depends on the restart policy of the service.
+			_, done := service.state.begin(c.ctx)
+			c.emitService(service, Event{Type: ServiceStarting})
+			sent, started := service.state.signalCount(), time.Now()
+			err := c.withHooks(service, func() error {
+				c.probeReady(service, done)
+				c.probeLive(service, done)
+				return c.execute(service, service.prepare())
+			})
+			restart, stopped := service.state.end(), sent != service.state.signalCount()
+			service.state.record(err, stopped)
+			if service.state.isRetired() {
+				return
+			}
+			if service.state.holdChan() != nil {
+				continue PROCESS
 			}
-		}()
+			if c.willRestart(service, err, stopped, restart) &&
+				c.waitRestart(service, bo.next(time.Since(started))) {
+				continue PROCESS
+			}
+			return
+		}
 	}
 }
 
@@ -249,121 +582,230 @@ func (c *config) executeCallback(service Service) {
 	if service.isCron() {
 		c.addTask(service)
 	} else {
-		c.wg.Add(1)
-		go func() {
-			defer c.wg.Done()
-			// If this callback is dead, we should restart it. (like a supervisor)
-			// So, this loop for that.
-		CALLBACK:
-			for {
-				// Notify you have run the callback
-				if c.execNotice {
-					service.ctx.Printf("Callback: %s\n", service.Tag)
-				}
-				select {
-				case <-c.ctx.Done():
-					return
-				default:
-					if err := service.Code(service.ctx); err != nil {
-						service.ctx.Printf("Callback Error: %s\n", err.Error())
-						continue CALLBACK
-					}
-					return
-				}
-			}
-		}()
+		c.enter()
+		go c.runCallback(service)
 	}
 }
 
-// Receive process ID to be executed. or
-// It traps the signal relate to parent process. sends a signal to the received process ID.
-func (c *config) waitSignals(chps <-chan *os.Process, cap int) {
-	procs := make([]*os.Process, 0, cap)
-Loop:
+// runCallback runs the callback of the worker, and restarts it by the restart policy.
+func (c *config) runCallback(service Service) {
+	defer c.leave()
+	defer c.exited(service)
+	// If this callback is dead, we should restart it. (like a supervisor)
+	// So, this loop for that.
+	bo := newBackoff(service.Backoff)
+CALLBACK:
 	for {
 		select {
-		case proc := <-chps:
-			// Replace used process(nil) with the newly generated process.
-			// This run to reduce the memory allocation frequency.
-			for i, p := range procs {
-				if p == nil {
-					procs[i] = proc
-					continue Loop
-				}
+		case <-c.ctx.Done():
+			return
+		case <-c.stop:
+			return
+		default:
+			if !c.waitHeld(service) {
+				return
 			}
-			// If using all processes, allocate newly.
-			procs = append(procs, proc)
-		case c.ctx.signal = <-c.ctx.sigchan:
-			switch c.ctx.signal {
-			case syscall.SIGTERM, syscall.SIGHUP:
-				// Send signals to each process as SIGTERM.
-				// However, In the case of Goroutine, it will notify the received signal. (SIGTERM or SIGHUP)
-				sendSignal2Procs(syscall.SIGTERM, procs)
-				c.ctx.notifySignal()
-			case syscall.SIGINT:
-				sendSignal2Procs(syscall.SIGINT, procs)
-				c.ctx.notifySignal()
+			runCtx, done := service.state.begin(c.ctx)
+			c.emitService(service, Event{Type: ServiceStarting})
+			sent, started := service.state.signalCount(), time.Now()
+			err := c.withHooks(service, func() error {
+				c.probeReady(service, done)
+				c.probeLive(service, done)
+				c.emitService(service, Event{Type: ServiceStarted})
+				c.postStart(service)
+				return service.Code(service.ctx.withRun(runCtx))
+			})
+			restart, stopped := service.state.end(), sent != service.state.signalCount()
+			service.state.record(err, stopped)
+			c.emitService(service, exitEvent(0, err))
+			if service.state.isRetired() {
+				return
 			}
-		case <-c.ctx.Done():
-			if 0 <= c.cancelSignal {
-				sendSignal2Procs(c.cancelSignal, procs)
-				c.ctx.notifySignal()
+			if service.state.holdChan() != nil {
+				continue CALLBACK
+			}
+			if c.willRestart(service, err, stopped, restart) &&
+				c.waitRestart(service, bo.next(time.Since(started))) {
+				continue CALLBACK
 			}
 			return
 		}
 	}
 }
 
-// sendSignal2Procs can send signal and replace os.Process struct of the terminated process with nil
-func sendSignal2Procs(sig syscall.Signal, procs []*os.Process) {
-	for i, p := range procs {
-		if p != nil {
-			p.Signal(sig)
-			// In case of error, the process has already finished.
-			if _, err := p.Wait(); err != nil {
-				procs[i] = nil
+// waitRestart waits for the delay before restarting the service.
+// It returns false if golet starts to stop services while waiting.
+func (c *config) waitRestart(service Service, delay time.Duration) bool {
+	service.state.set(StateBackoff)
+	c.emitService(service, Event{Type: ServiceRestarting, Delay: delay})
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-c.ctx.Done():
+		return false
+	case <-c.stop:
+		return false
+	case <-service.state.retiredChan():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// It traps the signal relate to parent process. sends a signal to services.
+func (c *config) waitSignals() {
+	for {
+		select {
+		case sig := <-c.ctx.sigchan:
+			if sig == syscall.SIGHUP && c.configPath != "" {
+				// Reload the config file instead of stopping services.
+				c.emit(Event{Type: SignalReceived, Signal: sig})
+				go c.reloadBySignal()
+				continue
+			}
+			if c.rollingSignal != 0 && sig == c.rollingSignal {
+				c.emit(Event{Type: SignalReceived, Signal: sig})
+				go c.rollingRestartAll()
+				continue
 			}
+			c.ctx.setSignal(sig)
+			c.emit(Event{Type: SignalReceived, Signal: sig})
+			// Send signals to each process as the stop signal of the service. (SIGTERM by default)
+			// However, In the case of Goroutine, it will notify the received signal.
+			if isStopSignal(sig) {
+				c.mu.Lock()
+				if c.stopSignal == nil {
+					c.stopSignal = sig
+				}
+				c.mu.Unlock()
+				c.shutdown(sig, sig)
+			} else {
+				c.forwardSignal(sig)
+			}
+		case <-c.ctx.Done():
+			// If cancel signal is not set, golet does not send any signal.
+			c.shutdown(nil, nil)
+			return
 		}
 	}
 }
 
-// Execute the command and send its process ID.
-func run(c *exec.Cmd, chps chan<- *os.Process) error {
-	if err := c.Start(); err != nil {
+// Execute the command and register its process to the worker while running.
+func (c *config) execute(service Service, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		c.emitService(service, exitEvent(0, err))
 		return err
 	}
-	chps <- c.Process
-	return c.Wait()
+	pid := cmd.Process.Pid
+	service.state.addCmdProc(cmd.Process)
+	c.emitService(service, Event{Type: ServiceStarted, PID: pid})
+	c.postStart(service)
+	err := cmd.Wait()
+	service.state.removeProc(cmd.Process)
+	c.emitService(service, exitEvent(pid, err))
+	return err
 }
 
-// Add a task to execute the command to cron.
-func (c *config) addCmd(s Service, chps chan<- *os.Process) {
-	// Notify you have executed the command
-	if c.execNotice {
-		s.ctx.Printf("Exec command: %s\n", s.Exec)
+// cronJob is a job of cron for the service.
+type cronJob struct {
+	service Service
+	fn      func()
+}
+
+// Run is implemented for cron.Job
+// The job is skipped while the worker is held stopped by the control API,
+// or removed but cron has not been replaced yet.
+func (j *cronJob) Run() {
+	if j.service.state.holdChan() == nil && !j.service.state.isRetired() {
+		j.fn()
+	}
+}
+
+// addJob adds the job of the service to cron.
+// Calls of cron are serialized because cron does not guard its running flag.
+func (c *config) addJob(s Service, fn func()) error {
+	s.state.setJob(fn)
+	c.cronMu.Lock()
+	defer c.cronMu.Unlock()
+	return c.cron.AddJob(s.Every, &cronJob{service: s, fn: fn})
+}
+
+// removeJobs replaces cron with the new one which has only jobs of workers not removed,
+// because cron does not have the way to remove jobs.
+func (c *config) removeJobs() {
+	c.cronMu.Lock()
+	defer c.cronMu.Unlock()
+	next := cron.New()
+	for _, e := range c.cron.Entries() {
+		if job, ok := e.Job.(*cronJob); ok && job.service.state.isRetired() {
+			continue
+		}
+		next.Schedule(e.Schedule, e.Job)
+	}
+	if c.cronActive {
+		c.cron.Stop()
+		next.Start()
 	}
-	c.cron.AddFunc(s.Every, func() {
-		run(s.prepare(), chps)
+	c.cron = next
+}
+
+// Add a task to execute the command to cron.
+func (c *config) addCmd(s Service) {
+	s.state.set(StateRunning)
+	c.emitService(s, Event{Type: ServiceStarting})
+	err := c.addJob(s, func() {
+		s.state.started(time.Now())
+		c.emitService(s, Event{Type: CronFired})
+		sent := s.state.signalCount()
+		err := c.withHooks(s, func() error {
+			return c.execute(s, s.prepare())
+		})
+		s.state.record(err, sent != s.state.signalCount())
 	})
+	if err != nil {
+		c.invalidCron(s, err)
+	}
 }
 
 // Add a task to execute the code block to cron.
 func (c *config) addTask(s Service) {
-	// Notify you have run the callback
-	if c.execNotice {
-		s.ctx.Printf("Callback: %s\n", s.Tag)
-	}
-	c.cron.AddFunc(s.Every, func() {
-		if err := s.Code(s.ctx); err != nil {
-			s.ctx.Printf("Callback Error: %s\n", err.Error())
-		}
+	s.state.set(StateRunning)
+	c.emitService(s, Event{Type: ServiceStarting})
+	err := c.addJob(s, func() {
+		s.state.started(time.Now())
+		c.emitService(s, Event{Type: CronFired})
+		sent := s.state.signalCount()
+		err := c.withHooks(s, func() error {
+			c.emitService(s, Event{Type: ServiceStarted})
+			c.postStart(s)
+			return s.Code(s.ctx)
+		})
+		s.state.record(err, sent != s.state.signalCount())
+		c.emitService(s, exitEvent(0, err))
 	})
+	if err != nil {
+		c.invalidCron(s, err)
+	}
+}
+
+// invalidCron marks the cron service FATAL because it could not be added to cron.
+func (c *config) invalidCron(s Service, err error) {
+	err = fmt.Errorf("invalid cron expression %q: %s", s.Every, err)
+	s.state.record(err, false)
+	s.state.set(StateFatal)
+	s.ctx.Printf("Cron Error: %s\n", err.Error())
 }
 
 // Wait services
-func (c *config) wait(chps chan<- *os.Process) {
+func (c *config) wait() {
+	c.cronMu.Lock()
 	c.cron.Start()
-	c.wg.Wait()
+	c.cronActive = true
+	c.cronMu.Unlock()
+	c.waitShutdown()
+	c.cronMu.Lock()
 	c.cron.Stop()
+	c.cronActive = false
+	c.cronMu.Unlock()
 	signal.Stop(c.ctx.sigchan)
 }
@@ -4,14 +4,23 @@ package golet
 
 import (
 	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/Code-Hex/golet/control"
 	colorable "github.com/mattn/go-colorable"
 	"github.com/stretchr/testify/assert"
 )
@@ -76,6 +85,46 @@ func TestAdd(t *testing.T) {
 	}
 }
 
+func TestValidate(t *testing.T) {
+	noop := func(context.Context) error { return nil }
+	assert.NoError(t, Service{Exec: "true", Every: "@every 1m", Worker: 100}.Validate())
+	assert.NoError(t, Service{Code: noop, Readiness: Probe{Notify: true}}.Validate())
+
+	for _, tc := range []struct {
+		service Service
+		msg     string
+	}{
+		{Service{Tag: "empty"}, `invalid service "empty": neither Exec nor Code is set`},
+		{Service{Exec: "true", Code: noop}, "invalid service: both Exec and Code are set"},
+		{Service{Exec: "true", Worker: 101}, "invalid service: Worker must be at most 100, got 101"},
+		{Service{Exec: "true", Every: "* * *"}, `invalid service: invalid cron expression "* * *": Expected 5 to 6 fields, found 3: * * *`},
+		{Service{Exec: "true", Every: "@hourly", Liveness: Probe{TCP: true}}, "invalid service: probes cannot be used with Every"},
+		{Service{Exec: "true", Every: "@hourly", Critical: true}, "invalid service: Critical cannot be used with Every"},
+		{Service{Exec: "true", Readiness: Probe{Notify: true, TCP: true}}, "invalid service: Readiness.Notify is only for Code, Readiness.Notify cannot be used with other checks"},
+		{Service{Exec: "true", Backoff: Backoff{Jitter: 2}}, "invalid service: Backoff.Jitter must be between 0 and 1, got 2"},
+	} {
+		assert.EqualError(t, tc.service.Validate(), tc.msg)
+	}
+
+	// Add adds none of services if some are invalid.
+	p := New(ctx)
+	err := p.Add(
+		Service{Exec: "true", Tag: "ok"},
+		Service{Tag: "a"},
+		Service{Exec: "true", Tag: "b", Every: "invalid"},
+		Service{Exec: "true", Worker: 101},
+	)
+	var errs ValidationErrors
+	if assert.True(t, errors.As(err, &errs)) && assert.Len(t, errs, 3) {
+		assert.Equal(t, "a", errs[0].Tag)
+		assert.Equal(t, "b", errs[1].Tag)
+		assert.Empty(t, errs[0].Arg)
+		assert.Equal(t, "services[3]", errs[2].Arg)
+		assert.EqualError(t, errs[2], "invalid service services[3]: Worker must be at most 100, got 101")
+	}
+	assert.Empty(t, p.Status())
+}
+
 func TestWait(t *testing.T) {
 	c := exec.Command("go", "build", "-o", "sleep", "sleep.go")
 	c.Dir = "_testdata"
@@ -87,24 +136,14 @@ func TestWait(t *testing.T) {
 	_ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 	p := New(_ctx)
+	p.DisableLogger()
 
-	chps := make(chan *os.Process, 1)
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT)
 
 	times := 3
-	go p.(*config).waitSignals(chps, times)
-
-	finch := make(chan bool)
 	for i := 0; i < times; i++ {
-		go func() {
-			cmd := exec.Command("./sleep", "5")
-			cmd.Dir = "_testdata"
-			if err := run(cmd, chps); err == nil {
-				panic(err)
-			}
-			finch <- true
-		}()
+		p.Add(Service{Exec: "_testdata/sleep 5"})
 	}
 
 	// Send a signal to self test
@@ -113,19 +152,1435 @@ func TestWait(t *testing.T) {
 		syscall.Kill(syscall.Getpid(), syscall.SIGHUP)
 	}()
 
+	p.Run()
+
+	if _ctx.Err() != nil {
+		t.Fatalf("Timeout: Could not send signals to all processes")
+	}
 	i := 0
-	for i < times {
-		select {
-		case <-finch:
+	for _, service := range p.(*config).services {
+		if service.state.get() == StateStopped {
 			i++
-		case <-_ctx.Done():
-			t.Fatalf("Timeout: Could not send signals to all processes")
 		}
 	}
+	assert.Equal(t, times, i, "Could not send signals to all processes")
+}
 
-	p.(*config).wait(chps)
+func TestStopTimeout(t *testing.T) {
+	_ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	// Stop services by context cancel.
+	stop, cancelStop := context.WithCancel(_ctx)
+	defer cancelStop()
+	p := New(stop)
+	p.DisableLogger()
+	p.SetCtxCancelSignal(syscall.SIGTERM)
+	p.Add(Service{
+		// Ignore SIGTERM
+		Exec:        "trap '' TERM; sleep 30 & wait",
+		StopTimeout: time.Second,
+	})
 
-	assert.Equal(t, times, i, "Could not send signals to all processes")
+	go func() {
+		time.Sleep(time.Millisecond * 500)
+		cancelStop()
+	}()
+
+	start := time.Now()
+	p.Run()
+
+	if _ctx.Err() != nil || time.Since(start) > time.Second*5 {
+		t.Fatalf("Could not kill the process ignoring SIGTERM")
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	_ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	// Stop services by context cancel.
+	stop, cancelStop := context.WithCancel(_ctx)
+	defer cancelStop()
+	p := New(stop)
+	p.DisableLogger()
+	p.SetCtxCancelSignal(syscall.SIGTERM)
+	p.SetShutdownTimeout(time.Millisecond * 500)
+	p.Add(Service{
+		// This callback ignores signals.
+		Code: func(c context.Context) error {
+			time.Sleep(time.Second * 30)
+			return nil
+		},
+	})
+
+	go func() {
+		time.Sleep(time.Millisecond * 500)
+		cancelStop()
+	}()
+
+	start := time.Now()
+	err := p.Run()
+
+	assert.Error(t, err)
+	if time.Since(start) > time.Second*5 {
+		t.Fatalf("Could not give up waiting for the callback")
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	p := New(ctx)
+	p.DisableLogger()
+	p.Add(
+		Service{Exec: "sleep 30", Restart: RestartAlways},
+		Service{
+			Code: func(c context.Context) error {
+				<-c.Done()
+				return nil
+			},
+			Restart: RestartAlways,
+		},
+	)
+
+	assert.Error(t, p.Wait(), "Wait before Start should fail")
+	assert.NoError(t, p.Start())
+	assert.Error(t, p.Start(), "Start twice should fail")
+
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- p.Wait() }()
+
+	time.Sleep(time.Millisecond * 500)
+	_ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	assert.NoError(t, p.Stop(_ctx))
+	assert.NoError(t, <-waitErr)
+
+	for _, id := range []string{"1.0", "2.0"} {
+		state, _ := p.State(id)
+		assert.Equal(t, StateStopped, state, id)
+	}
+}
+
+func TestStopRunError(t *testing.T) {
+	p := New(ctx)
+	p.DisableLogger()
+	p.Add(
+		Service{Exec: "exit 3", Restart: RestartNever},
+		Service{Exec: "sleep 30"},
+	)
+	assert.NoError(t, p.Start())
+	time.Sleep(time.Millisecond * 300)
+	assert.NoError(t, p.Stop(ctx))
+
+	var runErr *RunError
+	if assert.True(t, errors.As(p.Wait(), &runErr)) {
+		assert.Len(t, runErr.Services, 1)
+		assert.Nil(t, runErr.Signal, "golet did not receive any signal")
+	}
+}
+
+func TestRunError(t *testing.T) {
+	p := New(ctx)
+	p.DisableLogger()
+	failure := errors.New("failure")
+	p.Add(
+		Service{Exec: "exit 3", Tag: "exit", Restart: RestartNever},
+		Service{Exec: "kill -KILL $$", Tag: "killed", Restart: RestartNever},
+		Service{
+			Code: func(c context.Context) error {
+				return failure
+			},
+			Tag:     "code",
+			Restart: RestartNever,
+		},
+		Service{Exec: "true", Tag: "success"},
+	)
+	err := p.Run()
+
+	var runErr *RunError
+	if !errors.As(err, &runErr) {
+		t.Fatalf("Run should return *RunError: %v", err)
+	}
+	got := map[string]*ServiceError{}
+	for _, e := range runErr.Services {
+		got[e.ID] = e
+	}
+	assert.Len(t, got, 3)
+	assert.Equal(t, 3, got["exit.0"].ExitCode)
+	assert.Equal(t, StateStopped, got["exit.0"].State)
+	assert.Equal(t, syscall.SIGKILL, got["killed.0"].Signal)
+	assert.Equal(t, failure, got["code.0"].Err)
+	assert.True(t, errors.Is(err, failure))
+}
+
+func TestCritical(t *testing.T) {
+	_ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	p := New(_ctx)
+	p.DisableLogger()
+	p.Add(
+		Service{Exec: "sleep 30", Tag: "worker"},
+		Service{Exec: "sleep 1; exit 4", Tag: "web", Critical: true, Restart: RestartNever},
+	)
+	// Forwarded signals are not the signal to stop services.
+	go func() {
+		time.Sleep(time.Millisecond * 300)
+		syscall.Kill(syscall.Getpid(), syscall.SIGWINCH)
+	}()
+	err := p.Run()
+
+	if _ctx.Err() != nil {
+		t.Fatalf("Timeout: Could not stop all services")
+	}
+	var runErr *RunError
+	if !errors.As(err, &runErr) {
+		t.Fatalf("Run should return *RunError: %v", err)
+	}
+	assert.Equal(t, 4, runErr.ExitCode())
+	assert.Equal(t, "web.0", runErr.Reason.(*ServiceError).ID)
+	assert.Empty(t, runErr.Services)
+	assert.Nil(t, runErr.Signal, "golet did not receive any signal")
+}
+
+func TestCriticalCancel(t *testing.T) {
+	_ctx, cancel := context.WithCancel(ctx)
+	p := New(_ctx)
+	p.DisableLogger()
+	p.Add(Service{
+		Code: func(c context.Context) error {
+			<-c.Done()
+			return nil
+		},
+		Tag:      "web",
+		Critical: true,
+	})
+	time.AfterFunc(time.Millisecond*50, cancel)
+	// The critical service finished by context cancel does not stop services by itself.
+	assert.NoError(t, p.Run())
+}
+
+func TestStatus(t *testing.T) {
+	p := New(ctx)
+	p.DisableLogger()
+	p.Add(
+		Service{Exec: "sleep 30", Tag: "exec"},
+		Service{
+			Code: func(c context.Context) error {
+				<-c.Done()
+				return nil
+			},
+			Tag: "code",
+		},
+		Service{Exec: "true", Tag: "cron", Every: "@every 1h"},
+	)
+	assert.NoError(t, p.Start())
+	defer p.Stop(ctx)
+	time.Sleep(time.Millisecond * 500)
+
+	statuses := p.Status()
+	assert.Len(t, statuses, 3)
+	got := map[string]ServiceStatus{}
+	for _, s := range statuses {
+		got[s.ID] = s
+	}
+
+	exec := got["exec.0"]
+	assert.Equal(t, KindExec, exec.Kind)
+	assert.Equal(t, StateRunning, exec.State)
+	assert.NotZero(t, exec.PID)
+	assert.NotZero(t, exec.Port)
+	assert.False(t, exec.StartedAt.IsZero())
+
+	code := got["code.0"]
+	assert.Equal(t, KindCode, code.Kind)
+	assert.Equal(t, StateRunning, code.State)
+	assert.Zero(t, code.PID)
+
+	cron := got["cron.0"]
+	assert.Equal(t, KindCron, cron.Kind)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), cron.Next, time.Minute)
+}
+
+func TestEvents(t *testing.T) {
+	p := New(ctx)
+	p.DisableLogger()
+	p.Add(
+		Service{Exec: "exit 3", Tag: "exec", Restart: RestartNever},
+		Service{Exec: "sleep 30", Tag: "sleep"},
+	)
+	events := p.Events()
+	assert.NoError(t, p.Start())
+	time.Sleep(time.Millisecond * 500)
+	assert.NoError(t, p.Stop(ctx))
+
+	var got []Event
+	var shutdown bool
+	for e := range events {
+		switch e.ID {
+		case "exec.0":
+			got = append(got, e)
+		case "":
+			// golet did not receive any signal.
+			shutdown = shutdown || e.Type == ShutdownBegun && e.Signal == nil
+		}
+	}
+	assert.True(t, shutdown)
+	if assert.Len(t, got, 3) {
+		assert.Equal(t, ServiceStarting, got[0].Type)
+		assert.Equal(t, ServiceStarted, got[1].Type)
+		assert.NotZero(t, got[1].PID)
+		assert.Equal(t, ServiceExited, got[2].Type)
+		assert.Equal(t, got[1].PID, got[2].PID)
+		assert.Equal(t, 3, got[2].ExitCode)
+		assert.Error(t, got[2].Err)
+	}
+
+	// The channel is closed if golet has already finished.
+	_, ok := <-p.Events()
+	assert.False(t, ok)
+}
+
+func TestHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golet")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var mu sync.Mutex
+	var calls []string
+	hook := func(name string) Hook {
+		return Hook{Code: func(c *Context) error {
+			mu.Lock()
+			calls = append(calls, name)
+			mu.Unlock()
+			return nil
+		}}
+	}
+	marker := filepath.Join(dir, "prestart")
+	p := New(ctx)
+	p.DisableLogger()
+	p.Add(Service{
+		Exec:    "sleep 30",
+		Tag:     "web",
+		Backoff: Backoff{Initial: time.Millisecond * 10},
+		// PreStart fails at the first time.
+		PreStart:  Hook{Exec: "test -f " + marker + " || { touch " + marker + "; exit 1; }"},
+		PostStart: hook("PostStart"),
+		PreStop:   hook("PreStop"),
+		PostStop:  Hook{Exec: "echo $PORT > " + filepath.Join(dir, "poststop")},
+	})
+	assert.NoError(t, p.Start())
+	time.Sleep(time.Millisecond * 500)
+
+	st := p.Status()[0]
+	assert.Equal(t, StateRunning, st.State)
+	assert.Equal(t, 1, st.Restarts)
+	assert.NoError(t, p.Stop(ctx))
+
+	mu.Lock()
+	assert.Equal(t, []string{"PostStart", "PreStop"}, calls)
+	mu.Unlock()
+	b, err := ioutil.ReadFile(filepath.Join(dir, "poststop"))
+	assert.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(st.Port)+"\n", string(b))
+}
+
+func TestControl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golet")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "golet.sock")
+
+	var mu sync.Mutex
+	fired := 0
+	p := New(ctx)
+	p.DisableLogger()
+	p.SetControlSocket(sock)
+	p.Add(
+		Service{Exec: "sleep 30", Tag: "web", Backoff: Backoff{Initial: time.Millisecond}},
+		Service{
+			Code: func(c context.Context) error {
+				mu.Lock()
+				fired++
+				mu.Unlock()
+				c.(*Context).Println("fired")
+				return nil
+			},
+			Tag:   "job",
+			Every: "@every 1h",
+		},
+		Service{Exec: "echo once >> " + filepath.Join(dir, "once"), Tag: "once"},
+	)
+	assert.NoError(t, p.Start())
+	time.Sleep(time.Millisecond * 300)
+
+	cl := control.New(sock)
+	services, err := cl.Services(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, services, 3)
+	pid := services[0].PID
+	assert.NotZero(t, pid)
+
+	_, err = cl.Restart(ctx, "web.0")
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 300)
+	services, _ = cl.Services(ctx)
+	assert.Equal(t, "RUNNING", services[0].State)
+	assert.NotEqual(t, pid, services[0].PID)
+	assert.Equal(t, 1, services[0].Restarts)
+
+	services, err = cl.Stop(ctx, "web")
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 100)
+	services, _ = cl.Services(ctx)
+	assert.Equal(t, "STOPPED", services[0].State)
+	assert.Zero(t, services[0].PID)
+
+	_, err = cl.Start(ctx, "web")
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 300)
+	services, _ = cl.Services(ctx)
+	assert.Equal(t, "RUNNING", services[0].State)
+	assert.NotZero(t, services[0].PID)
+
+	logs := new(strings.Builder)
+	lctx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() { done <- cl.Logs(lctx, "job", logs) }()
+	time.Sleep(time.Millisecond * 100)
+	_, err = cl.Trigger(ctx, "job")
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 100)
+	mu.Lock()
+	assert.Equal(t, 1, fired)
+	mu.Unlock()
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Contains(t, logs.String(), "job.0      | fired\n")
+
+	// The finished worker runs again.
+	_, err = cl.Start(ctx, "once")
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 100)
+	b, _ := ioutil.ReadFile(filepath.Join(dir, "once"))
+	assert.Equal(t, "once\nonce\n", string(b))
+
+	var cerr *control.Error
+	_, err = cl.Trigger(ctx, "web")
+	if assert.True(t, errors.As(err, &cerr)) {
+		assert.Equal(t, http.StatusConflict, cerr.StatusCode)
+	}
+	_, err = cl.Restart(ctx, "unknown")
+	if assert.True(t, errors.As(err, &cerr)) {
+		assert.Equal(t, http.StatusNotFound, cerr.StatusCode)
+	}
+
+	assert.NoError(t, p.Stop(ctx))
+	_, err = os.Stat(sock)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestControlStopStarting(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golet")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "golet.sock")
+
+	p := New(ctx)
+	p.DisableLogger()
+	p.SetControlSocket(sock)
+	p.Add(Service{
+		Exec: "sleep 30",
+		Tag:  "web",
+		PreStart: Hook{Code: func(*Context) error {
+			time.Sleep(time.Millisecond * 300)
+			return nil
+		}},
+	})
+	assert.NoError(t, p.Start())
+	time.Sleep(time.Millisecond * 100)
+
+	// The command started after the stop is stopped too.
+	start := time.Now()
+	_, err = control.New(sock).Stop(ctx, "web")
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) < time.Second*5, time.Since(start))
+	state, _ := p.State("web.0")
+	assert.Equal(t, StateStopped, state)
+	assert.NoError(t, p.Stop(ctx))
+}
+
+func TestControlSocketInUse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golet")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "golet.sock")
+
+	// The socket left by the previous golet is replaced.
+	l, err := net.Listen("unix", sock)
+	assert.NoError(t, err)
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	p := New(ctx)
+	p.DisableLogger()
+	p.SetControlSocket(sock)
+	p.Add(Service{Exec: "sleep 30"})
+	assert.NoError(t, p.Start())
+
+	// The socket served by another golet is not.
+	q := New(ctx)
+	q.DisableLogger()
+	q.SetControlSocket(sock)
+	assert.EqualError(t, q.Start(), "control socket "+sock+" is already in use")
+	_, err = control.New(sock).Services(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Stop(ctx))
+}
+
+func TestProcfile(t *testing.T) {
+	services, err := ParseProcfile(strings.NewReader(`# comment
+web: plackup --port $PORT
+
+worker:  bundle exec sidekiq
+clock: ./clock.sh
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []Service{
+		{Exec: "plackup --port $PORT", Tag: "web"},
+		{Exec: "bundle exec sidekiq", Tag: "worker"},
+		{Exec: "./clock.sh", Tag: "clock"},
+	}, services)
+
+	f, err := ParseFormation("all=1, web=2,worker=3,clock=0")
+	assert.NoError(t, err)
+	services, err = f.Apply(services)
+	assert.NoError(t, err)
+	if assert.Len(t, services, 2) {
+		assert.Equal(t, 2, services[0].Worker)
+		assert.Equal(t, 3, services[1].Worker)
+	}
+	_, err = Formation{"api": 1}.Apply(services)
+	assert.EqualError(t, err, "formation: unknown service: api")
+	_, err = ParseFormation("web=x")
+	assert.Error(t, err)
+
+	for _, tc := range []struct {
+		in, err string
+	}{
+		{"web: a\nweb b", `line 2: invalid line: "web b"`},
+		{"web: a\n\nworker:", "line 3: missing command of worker"},
+		{"web: a\nweb: b", "line 2: web is already defined at line 1"},
+	} {
+		_, err := ParseProcfile(strings.NewReader(tc.in))
+		assert.EqualError(t, err, tc.err)
+	}
+
+	dir, err := ioutil.TempDir("", "golet")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "Procfile")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("web"), 0644))
+	_, err = LoadProcfile(path)
+	assert.EqualError(t, err, path+`:1: invalid line: "web"`)
+}
+
+func TestEnvFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golet")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	os.Setenv("GOLET_TEST_HOST", "host")
+	defer os.Unsetenv("GOLET_TEST_HOST")
+
+	global := filepath.Join(dir, "global.env")
+	assert.NoError(t, ioutil.WriteFile(global, []byte(`# comment
+export NAME=golet
+GREETING="hello ${NAME}\tfrom ${GOLET_TEST_HOST}"
+RAW='${NAME} is not expanded'
+ESCAPED=\${NAME} # comment
+OVERRIDE=global
+`), 0644))
+	local := filepath.Join(dir, "local.env")
+	assert.NoError(t, ioutil.WriteFile(local, []byte("OVERRIDE=${NAME}-local\nONLY=file\n"), 0644))
+
+	p := New(ctx)
+	p.DisableLogger()
+	assert.NoError(t, p.EnvFile(global))
+	envs := make(chan map[string]string, 1)
+	out := filepath.Join(dir, "out")
+	assert.NoError(t, p.Add(
+		Service{
+			Exec:    `echo "$GREETING|$RAW|$ESCAPED|$OVERRIDE|$ONLY" > ` + out,
+			Tag:     "exec",
+			EnvFile: []string{local},
+			Env:     map[string]string{"ONLY": "env"},
+		},
+		Service{
+			Code: func(c context.Context) error {
+				gc := c.(*Context)
+				envs <- map[string]string{
+					"GREETING": gc.Getenv("GREETING"),
+					"OVERRIDE": gc.Getenv("OVERRIDE"),
+					"PORT":     gc.Getenv("PORT"),
+				}
+				return nil
+			},
+			Tag: "code",
+		},
+	))
+	assert.NoError(t, p.Run())
+
+	b, err := ioutil.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello golet\tfrom host|${NAME} is not expanded|${NAME}|golet-local|env\n", string(b))
+	env := <-envs
+	assert.Equal(t, "hello golet\tfrom host", env["GREETING"])
+	assert.Equal(t, "global", env["OVERRIDE"])
+	assert.NotEmpty(t, env["PORT"])
+	_, ok := os.LookupEnv("NAME")
+	assert.False(t, ok)
+
+	bad := filepath.Join(dir, "bad.env")
+	assert.NoError(t, ioutil.WriteFile(bad, []byte("A=1\nB=\"unterminated\n"), 0644))
+	assert.EqualError(t, New(ctx).EnvFile(bad), bad+":2: unterminated double quote")
+	assert.Error(t, New(ctx).Add(Service{Exec: "true", EnvFile: []string{filepath.Join(dir, "none")}}))
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golet")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".env"), []byte("NAME=golet\n"), 0644))
+
+	files := map[string]string{
+		"golet.yaml": `
+interval: 1s
+color: true
+env_file: .env
+services:
+  - tag: web
+    exec: plackup --port $PORT
+    worker: 2
+    dir: app
+    restart: always
+    env:
+      PLACK_ENV: production
+    backoff:
+      initial: 1s
+      multiplier: 1.5
+    readiness:
+      http: /health
+  - tag: cron
+    exec: ./batch.sh
+    every: "@hourly"
+    depends_on: [web]
+    stop_signal: QUIT
+    pre_start: ./setup.sh
+`,
+		"golet.toml": `
+interval = "1s"
+color = true
+env_file = [".env"]
+
+[[services]]
+tag = "web"
+exec = "plackup --port $PORT"
+worker = 2
+dir = "app"
+restart = "always"
+env = { PLACK_ENV = "production" }
+backoff = { initial = "1s", multiplier = 1.5 }
+readiness = { http = "/health" }
+
+[[services]]
+tag = "cron"
+exec = "./batch.sh"
+every = "@hourly"
+depends_on = ["web"]
+stop_signal = "QUIT"
+pre_start = "./setup.sh"
+`,
+		"golet.json": `{
+  "interval": "1s",
+  "color": true,
+  "env_file": ".env",
+  "services": [
+    {"tag": "web", "exec": "plackup --port $PORT", "worker": 2, "dir": "app", "restart": "always",
+     "env": {"PLACK_ENV": "production"}, "backoff": {"initial": "1s", "multiplier": 1.5}, "readiness": {"http": "/health"}},
+    {"tag": "cron", "exec": "./batch.sh", "every": "@hourly", "depends_on": ["web"], "stop_signal": "QUIT", "pre_start": "./setup.sh"}
+  ]
+}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+		r, err := LoadConfig(path)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		c := r.(*config)
+		assert.Equal(t, time.Second, c.interval, name)
+		assert.True(t, c.color, name)
+		if !assert.Len(t, c.services, 3, name) {
+			continue
+		}
+		web, cron := c.services[0], c.services[2]
+		assert.Equal(t, "web.0", web.id, name)
+		assert.Equal(t, filepath.Join(dir, "app"), web.Dir, name)
+		assert.Equal(t, RestartAlways, web.Restart, name)
+		assert.Equal(t, Backoff{Initial: time.Second, Multiplier: 1.5}, web.Backoff, name)
+		assert.Equal(t, "/health", web.Readiness.HTTP, name)
+		assert.Equal(t, "production", web.ctx.Getenv("PLACK_ENV"), name)
+		assert.Equal(t, "golet", web.ctx.Getenv("NAME"), name)
+		assert.Equal(t, "@hourly", cron.Every, name)
+		assert.Equal(t, []string{"web"}, cron.DependsOn, name)
+		assert.Equal(t, syscall.SIGQUIT, cron.StopSignal, name)
+		assert.Equal(t, "./setup.sh", cron.PreStart.Exec, name)
+	}
+
+	for content, msg := range map[string]string{
+		`{"services": [{"exec": "true", "wroker": 2}]}`:            "services[0].wroker: unknown key",
+		`{"services": [{"exec": "true", "restart": "sometimes"}]}`: `services[0].restart: unknown restart policy: "sometimes"`,
+		`{"services": [{"exec": "true"}, {"tag": "b"}]}`:           "services[1].exec: required",
+		`{"services": [{"exec": "true", "worker": "2"}]}`:          "services[0].worker: must be an integer, got 2",
+		`{"interval": "soon"}`:                                     `interval: invalid duration: "soon"`,
+		`{"services": [{"exec": "true", "backoff": {"max": 1}}]}`:  "services[0].backoff.max: must be a string, got 1",
+		`{"services": [{"exec": "true", "env": {"A": [1]}}]}`:      "services[0].env.A: must be a scalar value, got [1]",
+	} {
+		path := filepath.Join(dir, "invalid.json")
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+		_, err := LoadConfig(path)
+		assert.EqualError(t, err, path+": "+msg)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golet")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "golet.yaml")
+	write := func(content string) {
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+	pids := func(p Runner) map[string]int {
+		m := map[string]int{}
+		for _, s := range p.Status() {
+			m[s.ID] = s.PID
+		}
+		return m
+	}
+
+	write(`
+services:
+  - tag: keep
+    exec: sleep 30
+  - tag: drop
+    exec: sleep 30
+  - tag: change
+    exec: sleep 30
+    env:
+      NAME: old
+`)
+	p, err := LoadConfig(path)
+	assert.NoError(t, err)
+	p.DisableLogger()
+	assert.NoError(t, p.Start())
+	time.Sleep(time.Millisecond * 300)
+	before := pids(p)
+	assert.Len(t, before, 3)
+
+	write(`
+services:
+  - tag: keep
+    exec: sleep 30
+  - tag: change
+    exec: sleep 30
+    env:
+      NAME: new
+  - tag: add
+    exec: sleep 30
+    worker: 2
+`)
+	assert.NoError(t, p.Reload())
+	time.Sleep(time.Millisecond * 300)
+	after := pids(p)
+	assert.Len(t, after, 4)
+	assert.Equal(t, before["keep.0"], after["keep.0"])
+	assert.NotContains(t, after, "drop.0")
+	assert.NotZero(t, after["change.0"])
+	assert.NotEqual(t, before["change.0"], after["change.0"])
+	assert.NotZero(t, after["add.0"])
+	assert.NotZero(t, after["add.1"])
+	assert.Equal(t, syscall.ESRCH, syscall.Kill(before["drop.0"], 0))
+
+	// SIGHUP reloads the file instead of stopping services.
+	write(`
+services:
+  - tag: keep
+    exec: sleep 30
+`)
+	syscall.Kill(syscall.Getpid(), syscall.SIGHUP)
+	time.Sleep(time.Millisecond * 500)
+	assert.Equal(t, map[string]int{"keep.0": before["keep.0"]}, pids(p))
+
+	// Nothing changes if the file is invalid.
+	write(`
+services:
+  - tag: keep
+    exec: sleep 30
+    depends_on: [unknown]
+`)
+	assert.EqualError(t, p.Reload(), path+": tag: keep depends on unknown tag: unknown")
+	assert.Equal(t, map[string]int{"keep.0": before["keep.0"]}, pids(p))
+
+	// Cron entries of replaced services do not pile up.
+	for i := 0; i < 3; i++ {
+		write(`
+services:
+  - tag: keep
+    exec: sleep 30
+  - tag: job
+    exec: echo ` + strconv.Itoa(i) + `
+    every: "@every 1h"
+`)
+		assert.NoError(t, p.Reload())
+	}
+	assert.Equal(t, 1, cronEntries(p))
+
+	assert.NoError(t, p.Stop(ctx))
+	assert.Equal(t, errNoConfig, New(ctx).Reload())
+}
+
+func TestAddRemoveRunning(t *testing.T) {
+	var mu sync.Mutex
+	fired := 0
+	p := New(ctx)
+	p.DisableLogger()
+	p.Add(Service{Exec: "sleep 30", Tag: "base"})
+	assert.NoError(t, p.Start())
+	time.Sleep(time.Millisecond * 100)
+
+	assert.NoError(t, p.Add(
+		Service{Exec: "sleep 30", Tag: "late", DependsOn: []string{"base"}},
+		Service{
+			Code: func(c context.Context) error {
+				mu.Lock()
+				fired++
+				mu.Unlock()
+				return nil
+			},
+			Tag:   "job",
+			Every: "@every 1s",
+		},
+	))
+	assert.EqualError(t, p.Add(Service{Exec: "true", Tag: "late"}), "tag: late is already exists")
+	time.Sleep(time.Millisecond * 1200)
+	mu.Lock()
+	assert.NotZero(t, fired)
+	mu.Unlock()
+
+	statuses := p.Status()
+	assert.Len(t, statuses, 3)
+	var late ServiceStatus
+	for _, s := range statuses {
+		if s.ID == "late.0" {
+			late = s
+		}
+	}
+	assert.Equal(t, StateRunning, late.State)
+	assert.NotZero(t, late.PID)
+
+	assert.EqualError(t, p.Remove("base"), "tag: base is depended on by late")
+	assert.EqualError(t, p.Remove("unknown"), "tag: unknown does not exist")
+	assert.NoError(t, p.Remove("late"))
+	assert.Equal(t, syscall.ESRCH, syscall.Kill(late.PID, 0))
+	_, ok := p.State("late.0")
+	assert.False(t, ok)
+
+	// The tag and the port are reused.
+	assert.NoError(t, p.Add(Service{Exec: "sleep 30", Tag: "late"}))
+	for _, s := range p.Status() {
+		if s.ID == "late.0" {
+			assert.Equal(t, late.Port, s.Port)
+		}
+	}
+	assert.EqualError(t, p.Add(Service{Exec: "true", Tag: "x", DependsOn: []string{"none"}}), "tag: x depends on unknown tag: none")
+
+	assert.NoError(t, p.Remove("job"))
+	assert.Equal(t, 0, cronEntries(p))
+	mu.Lock()
+	n := fired
+	mu.Unlock()
+	time.Sleep(time.Millisecond * 1200)
+	mu.Lock()
+	assert.Equal(t, n, fired)
+	mu.Unlock()
+	assert.Len(t, p.Status(), 2)
+
+	assert.NoError(t, p.Stop(ctx))
+	assert.Error(t, p.Add(Service{Exec: "true"}))
+}
+
+func TestAddWhileFinishing(t *testing.T) {
+	p := New(ctx)
+	p.DisableLogger()
+	p.Add(Service{Exec: "sleep 0.05", Restart: RestartNever})
+	assert.NoError(t, p.Start())
+	for i := 0; i < 4; i++ {
+		go func() {
+			for p.Add(Service{Exec: "true", Restart: RestartNever}) == nil {
+			}
+		}()
+	}
+	// Wait must not panic while services are added, and they keep golet running until they finish.
+	p.Wait()
+	assert.Error(t, p.Add(Service{Exec: "true"}))
+}
+
+func TestRemoveJustAdded(t *testing.T) {
+	p := New(ctx)
+	p.DisableLogger()
+	p.Add(Service{Exec: "sleep 30", Tag: "base"})
+	assert.NoError(t, p.Start())
+	time.Sleep(time.Millisecond * 100)
+
+	// The stop signal is not lost even if the process has not started yet.
+	start := time.Now()
+	assert.NoError(t, p.Add(Service{Exec: "sleep 30", Tag: "late"}))
+	assert.NoError(t, p.Remove("late"))
+	assert.NoError(t, p.Scale("base", 2))
+	assert.NoError(t, p.Scale("base", 1))
+	assert.True(t, time.Since(start) < time.Second*5, time.Since(start))
+	assert.NoError(t, p.Stop(ctx))
+}
+
+// cronEntries returns the number of jobs in cron of the runner.
+func cronEntries(p Runner) int {
+	c := p.(*config)
+	c.cronMu.Lock()
+	defer c.cronMu.Unlock()
+	return len(c.cron.Entries())
+}
+
+func TestScale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golet")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "golet.sock")
+
+	var mu sync.Mutex
+	fired := map[int]int{}
+	p := New(ctx)
+	p.DisableLogger()
+	p.SetControlSocket(sock)
+	p.Add(
+		Service{Exec: "sleep 30", Tag: "web"},
+		Service{
+			Code: func(c context.Context) error {
+				mu.Lock()
+				fired[c.(*Context).Port()]++
+				mu.Unlock()
+				return nil
+			},
+			Tag:   "job",
+			Every: "@every 1s",
+		},
+	)
+	// Before Start, it changes the number of workers to launch.
+	assert.NoError(t, p.Scale("web", 2))
+	assert.NoError(t, p.Start())
+	time.Sleep(time.Millisecond * 300)
+	assert.Len(t, p.Status(), 3)
+
+	assert.NoError(t, p.Scale("web", 3))
+	assert.NoError(t, p.Scale("job", 2))
+	time.Sleep(time.Millisecond * 1200)
+	statuses := p.Status()
+	if assert.Len(t, statuses, 5) {
+		for i, s := range statuses[:3] {
+			assert.Equal(t, "web."+strconv.Itoa(i), s.ID)
+			assert.Equal(t, statuses[0].Port+i, s.Port)
+			assert.Equal(t, StateRunning, s.State)
+			assert.NotZero(t, s.PID)
+		}
+		assert.Equal(t, "job.1", statuses[4].ID)
+		mu.Lock()
+		assert.NotZero(t, fired[statuses[4].Port])
+		mu.Unlock()
+	}
+
+	services, err := control.New(sock).Scale(ctx, "web", 1)
+	assert.NoError(t, err)
+	assert.Len(t, services, 1)
+	for _, s := range statuses[1:3] {
+		assert.Equal(t, syscall.ESRCH, syscall.Kill(s.PID, 0))
+	}
+	assert.NoError(t, p.Scale("job", 1))
+	_, ok := p.State("job.1")
+	assert.False(t, ok)
+	assert.Equal(t, 1, cronEntries(p))
+
+	assert.EqualError(t, p.Scale("web", 0), "invalid number of workers: 0 (1-100)")
+	assert.EqualError(t, p.Scale("unknown", 1), "tag: unknown does not exist")
+	var cerr *control.Error
+	_, err = control.New(sock).Scale(ctx, "web.0", 2)
+	if assert.True(t, errors.As(err, &cerr)) {
+		assert.Equal(t, http.StatusNotFound, cerr.StatusCode)
+	}
+	assert.NoError(t, p.Stop(ctx))
+}
+
+func TestRollingRestart(t *testing.T) {
+	var mu sync.Mutex
+	ready, minReady := 0, 4
+	p := New(ctx)
+	p.DisableLogger()
+	p.SetRollingRestartSignal(syscall.SIGUSR2)
+	p.Add(Service{
+		Code: func(c context.Context) error {
+			time.Sleep(time.Millisecond * 100)
+			mu.Lock()
+			ready++
+			mu.Unlock()
+			c.(*Context).Ready()
+			<-c.Done()
+			mu.Lock()
+			if ready--; ready < minReady {
+				minReady = ready
+			}
+			mu.Unlock()
+			return nil
+		},
+		Tag:            "web",
+		Worker:         4,
+		MaxUnavailable: 2,
+		Readiness:      Probe{Notify: true},
+	})
+	assert.NoError(t, p.Start())
+	time.Sleep(time.Millisecond * 300)
+
+	assert.NoError(t, p.RollingRestart("web"))
+	mu.Lock()
+	assert.Equal(t, 4, ready)
+	assert.Equal(t, 2, minReady)
+	mu.Unlock()
+	for _, s := range p.Status() {
+		assert.Equal(t, 1, s.Restarts, s.ID)
+		assert.Equal(t, StateRunning, s.State, s.ID)
+	}
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR2)
+	time.Sleep(time.Millisecond * 800)
+	for _, s := range p.Status() {
+		assert.Equal(t, 2, s.Restarts, s.ID)
+	}
+	assert.EqualError(t, p.RollingRestart("unknown"), "tag: unknown does not exist")
+	assert.NoError(t, p.Stop(ctx))
+}
+
+func TestRollingRestartRetries(t *testing.T) {
+	p := New(ctx)
+	p.DisableLogger()
+	p.Add(Service{Exec: "sleep 30", Tag: "w", StartRetries: 1})
+	assert.NoError(t, p.Start())
+	time.Sleep(time.Millisecond * 100)
+
+	// Requested restarts are not crashes.
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, p.RollingRestart("w"))
+	}
+	st := p.Status()[0]
+	assert.Equal(t, StateRunning, st.State)
+	assert.Equal(t, 3, st.Restarts)
+	assert.NoError(t, p.Stop(ctx))
+}
+
+func TestRollingRestartTimeout(t *testing.T) {
+	p := New(ctx)
+	p.DisableLogger()
+	p.Add(Service{
+		Code: func(c context.Context) error {
+			time.Sleep(time.Hour)
+			return nil
+		},
+		Tag:          "w",
+		Worker:       2,
+		StopTimeout:  time.Millisecond * 200,
+		ReadyTimeout: time.Millisecond * 200,
+	})
+	assert.NoError(t, p.Start())
+	time.Sleep(time.Millisecond * 100)
+
+	// The callback ignores cancellation, so it gives up and other changes are not blocked.
+	assert.EqualError(t, p.RollingRestart("w"), "w.0 did not restart in 400ms")
+	assert.NoError(t, p.Scale("w", 3))
+	_ctx, cancel := context.WithTimeout(ctx, time.Millisecond*100)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, p.Stop(_ctx))
+}
+
+func TestSignalFor(t *testing.T) {
+	p := New(ctx).(*config)
+	p.SetCtxCancelSignal(syscall.SIGINT)
+	nginx := Service{
+		StopSignal: syscall.SIGQUIT,
+		Signals:    map[syscall.Signal]syscall.Signal{syscall.SIGUSR2: syscall.SIGHUP},
+	}
+	cases := []struct {
+		service Service
+		sig     os.Signal
+		want    syscall.Signal
+		ok      bool
+	}{
+		{Service{}, syscall.SIGTERM, syscall.SIGTERM, true},
+		{Service{}, syscall.SIGHUP, syscall.SIGTERM, true},
+		{Service{}, syscall.SIGINT, syscall.SIGINT, true},
+		{Service{}, syscall.SIGUSR1, 0, false},
+		{Service{}, nil, syscall.SIGINT, true},
+		{nginx, syscall.SIGTERM, syscall.SIGQUIT, true},
+		{nginx, syscall.SIGUSR2, syscall.SIGHUP, true},
+		{nginx, nil, syscall.SIGQUIT, true},
+	}
+	for _, c := range cases {
+		got, ok := p.signalFor(c.service, c.sig)
+		assert.Equal(t, c.ok, ok, "signal: %v", c.sig)
+		assert.Equal(t, c.want, got, "signal: %v", c.sig)
+	}
+}
+
+func TestForwardSignal(t *testing.T) {
+	_ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	p := New(_ctx)
+	p.DisableLogger()
+	p.Add(Service{
+		Exec:    "trap 'exit 0' USR2; sleep 30 & wait",
+		Signals: map[syscall.Signal]syscall.Signal{syscall.SIGUSR1: syscall.SIGUSR2},
+		Restart: RestartNever,
+	})
+
+	// Send a signal to self test
+	go func() {
+		time.Sleep(time.Second * 1)
+		syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	}()
+	p.Run()
+
+	if _ctx.Err() != nil {
+		t.Fatalf("Timeout: Could not forward the signal")
+	}
+}
+
+func TestForwardSignalCrash(t *testing.T) {
+	p := New(ctx)
+	p.DisableLogger()
+	var mu sync.Mutex
+	count := 0
+	p.Add(
+		Service{
+			Exec:    "trap 'exit 1' USR2; sleep 30 & wait",
+			Tag:     "exec",
+			Signals: map[syscall.Signal]syscall.Signal{syscall.SIGUSR1: syscall.SIGUSR2},
+			Backoff: Backoff{Initial: time.Millisecond * 10},
+		},
+		Service{
+			Code: func(c context.Context) error {
+				mu.Lock()
+				count++
+				first := count == 1
+				mu.Unlock()
+				if !first {
+					<-c.Done()
+					return nil
+				}
+				<-c.(*Context).Recv()
+				return errors.New("failure")
+			},
+			Tag:     "code",
+			Backoff: Backoff{Initial: time.Millisecond * 10},
+		},
+	)
+	assert.NoError(t, p.Start())
+	time.Sleep(time.Millisecond * 500)
+
+	// Services which crash after a forwarded signal are restarted by the default policy.
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	time.Sleep(time.Millisecond * 500)
+	for _, st := range p.Status() {
+		assert.Equal(t, StateRunning, st.State, st.ID)
+		assert.Equal(t, 1, st.Restarts, st.ID)
+	}
+	assert.NoError(t, p.Stop(ctx))
+}
+
+func TestDependencyOrder(t *testing.T) {
+	services := []Service{
+		{Tag: "web", DependsOn: []string{"db", "cache"}},
+		{Tag: "worker", DependsOn: []string{"db"}},
+		{Tag: "db"},
+		{Tag: "cache"},
+	}
+	order, err := dependencyOrder(services, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"db", "cache", "web", "worker"}, order)
+
+	_, err = dependencyOrder(append(services, Service{Tag: "cron", DependsOn: []string{"unknown"}}), true)
+	assert.EqualError(t, err, "tag: cron depends on unknown tag: unknown")
+
+	services[2].DependsOn = []string{"worker"}
+	_, err = dependencyOrder(services, false)
+	assert.EqualError(t, err, "dependency cycle: db -> worker -> db")
+}
+
+func TestAddDependencyCycle(t *testing.T) {
+	p := New(ctx)
+	assert.NoError(t, p.Add(Service{Exec: "true", Tag: "a", DependsOn: []string{"b"}}))
+	assert.Error(t, p.Add(Service{Exec: "true", Tag: "b", DependsOn: []string{"a"}}))
+	assert.Error(t, p.Add(Service{Exec: "true", Tag: "c", DependsOn: []string{"c"}}))
+
+	// Run rejects unknown dependencies.
+	assert.Error(t, p.Run())
+}
+
+func TestProbe(t *testing.T) {
+	p := New(ctx)
+	p.Add(Service{Exec: "true"})
+	service := p.(*config).services[0]
+
+	tcp := Probe{TCP: true}
+	assert.Error(t, tcp.check(service))
+	l, err := net.Listen("tcp", service.ctx.ServePort())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer l.Close()
+	assert.NoError(t, tcp.check(service))
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+	assert.NoError(t, Probe{HTTP: ts.URL + "/health"}.check(service))
+	assert.Error(t, Probe{HTTP: ts.URL + "/"}.check(service))
+
+	assert.NoError(t, Probe{Exec: "test $PORT = " + strconv.Itoa(service.ctx.Port())}.check(service))
+	assert.Error(t, Probe{Exec: "exit 1"}.check(service))
+	assert.Error(t, Probe{Exec: "sleep 10", Timeout: time.Millisecond * 100}.check(service))
+}
+
+func TestReadiness(t *testing.T) {
+	_ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	p := New(_ctx)
+	p.DisableLogger()
+
+	var ready, started time.Time
+	p.Add(
+		Service{
+			Code: func(c context.Context) error {
+				started = time.Now()
+				cancel()
+				return nil
+			},
+			Tag:       "web",
+			DependsOn: []string{"db"},
+		},
+		Service{
+			Code: func(c context.Context) error {
+				time.Sleep(time.Millisecond * 500)
+				ready = time.Now()
+				c.(*Context).Ready()
+				<-c.Done()
+				return nil
+			},
+			Tag:       "db",
+			Readiness: Probe{Notify: true},
+		},
+	)
+	p.Run()
+
+	if started.Before(ready) {
+		t.Fatalf("Dependent service started before the service is ready")
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	_ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	p := New(_ctx)
+	p.DisableLogger()
+
+	var mu sync.Mutex
+	count, healthy := 0, true
+	p.Add(Service{
+		Code: func(c context.Context) error {
+			mu.Lock()
+			count++
+			healthy = count > 1
+			if count == 2 {
+				cancel()
+			}
+			mu.Unlock()
+			<-c.Done()
+			return nil
+		},
+		Liveness: Probe{
+			Func: func(c context.Context) error {
+				mu.Lock()
+				defer mu.Unlock()
+				if !healthy {
+					return errors.New("unhealthy")
+				}
+				return nil
+			},
+			Interval:         time.Millisecond * 100,
+			FailureThreshold: 2,
+		},
+		Restart: RestartNever,
+	})
+	p.Run()
+
+	assert.Equal(t, 2, count, "Unhealthy callback should be restarted")
+}
+
+func TestRestartPolicy(t *testing.T) {
+	failure := errors.New("failure")
+	cases := []struct {
+		policy  RestartPolicy
+		err     error
+		stopped bool
+		want    bool
+	}{
+		{RestartOnFailure, nil, false, false},
+		{RestartOnFailure, failure, false, true},
+		{RestartOnFailure, failure, true, false},
+		{RestartAlways, nil, false, true},
+		{RestartAlways, failure, true, true},
+		{RestartUnlessStopped, nil, false, true},
+		{RestartUnlessStopped, failure, true, false},
+		{RestartNever, nil, false, false},
+		{RestartNever, failure, false, false},
+	}
+	for _, c := range cases {
+		got := c.policy.shouldRestart(c.err, c.stopped)
+		assert.Equal(t, c.want, got, "policy: %s, err: %v, stopped: %v", c.policy, c.err, c.stopped)
+	}
+}
+
+func TestRestartAlways(t *testing.T) {
+	_ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	p := New(_ctx)
+	p.DisableLogger()
+
+	count := 0
+	p.Add(Service{
+		Code: func(c context.Context) error {
+			count++
+			if count == 3 {
+				cancel()
+			}
+			return nil
+		},
+		Restart: RestartAlways,
+	})
+	p.Run()
+
+	assert.Equal(t, 3, count, "Callback should be restarted until context cancel")
+}
+
+func TestBackoff(t *testing.T) {
+	bo := newBackoff(Backoff{
+		Initial:    time.Second,
+		Max:        time.Second * 5,
+		Multiplier: 2,
+		ResetAfter: time.Minute,
+	})
+	for _, want := range []time.Duration{1, 2, 4, 5, 5} {
+		assert.Equal(t, want*time.Second, bo.next(0))
+	}
+	// The delay is reset if the service has been running long enough.
+	assert.Equal(t, time.Second, bo.next(time.Minute))
+
+	bo = newBackoff(Backoff{Initial: time.Second, Jitter: 0.5})
+	for i := 0; i < 10; i++ {
+		bo.delay = 0
+		d := bo.next(0)
+		if d < time.Second/2 || time.Second*3/2 < d {
+			t.Fatalf("delay %s is out of jitter range", d)
+		}
+	}
+}
+
+func TestFatal(t *testing.T) {
+	_ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	p := New(_ctx)
+	p.DisableLogger()
+	p.EnableExitOnFatal()
+
+	count := 0
+	p.Add(
+		Service{
+			Code: func(c context.Context) error {
+				count++
+				return errors.New("failure")
+			},
+			Tag:          "crash",
+			Backoff:      Backoff{Initial: time.Millisecond},
+			StartRetries: 2,
+		},
+	)
+	err := p.Run()
+
+	assert.Error(t, err)
+	assert.Equal(t, 3, count, "Callback should be restarted StartRetries times")
+	state, ok := p.State("crash.0")
+	assert.True(t, ok)
+	assert.Equal(t, StateFatal, state)
+}
+
+func TestKillProcGroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golet")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	pidfile := filepath.Join(dir, "pid")
+
+	_ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	p := New(_ctx)
+	p.DisableLogger()
+	p.SetCtxCancelSignal(syscall.SIGTERM)
+	p.Add(Service{
+		// Write the process ID of the grandchild.
+		Exec: "sleep 30 | sleep 30 & echo $! > " + pidfile + "; wait",
+		Tag:  "pipeline",
+	})
+
+	// Wait for the grandchild to finish after context cancel.
+	done := make(chan int, 1)
+	go func() {
+		pid := 0
+		for pid == 0 {
+			time.Sleep(time.Millisecond * 100)
+			b, _ := ioutil.ReadFile(pidfile)
+			pid, _ = strconv.Atoi(strings.TrimSpace(string(b)))
+		}
+		cancel()
+		for i := 0; i < 50; i++ {
+			if err := syscall.Kill(pid, 0); err == syscall.ESRCH {
+				done <- 0
+				return
+			}
+			time.Sleep(time.Millisecond * 100)
+		}
+		done <- pid
+	}()
+	p.Run()
+
+	if pid := <-done; pid != 0 {
+		t.Fatalf("Grandchild process %d is still alive", pid)
+	}
 }
 
 func ServiceGen() []Service {
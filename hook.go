@@ -0,0 +1,74 @@
+package golet
+
+import (
+	"fmt"
+)
+
+// Hook is a command or a callback run at a point of the lifecycle of the worker.
+// If both are set, Exec runs first.
+type Hook struct {
+	Exec string               // Command to run. "$PORT" is replaced with the assigned port.
+	Code func(*Context) error // Callback to run.
+}
+
+func (h Hook) enabled() bool {
+	return h.Exec != "" || h.Code != nil
+}
+
+// runHook runs the hook of the worker, and logs its error.
+// The process of the hook is killed with the worker if it does not exit in time.
+func (c *config) runHook(service Service, name string, h Hook) error {
+	if !h.enabled() {
+		return nil
+	}
+	var err error
+	if h.Exec != "" {
+		cmd := service.command(h.Exec)
+		if err = cmd.Start(); err == nil {
+			service.state.addProc(cmd.Process)
+			err = cmd.Wait()
+			service.state.removeProc(cmd.Process)
+		}
+	}
+	if err == nil && h.Code != nil {
+		err = h.Code(service.ctx)
+	}
+	if err != nil {
+		err = fmt.Errorf("%s hook: %w", name, err)
+		service.ctx.Printf("Hook Error: %s\n", err.Error())
+	}
+	return err
+}
+
+// withHooks runs fn between PreStart and PostStop hooks of the worker.
+// If PreStart fails, fn is not run and the error is returned as the result of the run.
+func (c *config) withHooks(service Service, fn func() error) error {
+	if err := c.runHook(service, "PreStart", service.PreStart); err != nil {
+		c.emitService(service, exitEvent(0, err))
+		return err
+	}
+	err := fn()
+	c.runHook(service, "PostStop", service.PostStop)
+	return err
+}
+
+// postStart runs PostStart hook of the worker without blocking it.
+func (c *config) postStart(service Service) {
+	if service.PostStart.enabled() {
+		go c.runHook(service, "PostStart", service.PostStart)
+	}
+}
+
+// preStop runs PreStop hook of the worker before golet sends the stop signal to it.
+// It is not run if the worker has already finished or is held stopped.
+func (c *config) preStop(service Service) {
+	select {
+	case <-service.state.finishedChan():
+		return
+	default:
+	}
+	if service.state.get() == StateStopped {
+		return
+	}
+	c.runHook(service, "PreStop", service.PreStop)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 )
 
 const (
@@ -12,7 +13,11 @@ const (
 	minRegisteredPort = 1024
 )
 
-var previousPort = minRegisteredPort
+var (
+	mu           sync.Mutex
+	previousPort = minRegisteredPort
+	released     []int // ports released to be reused.
+)
 
 // IsPortAvailable returns a flag is TCP port available.
 func IsPortAvailable(port int) bool {
@@ -28,7 +33,17 @@ func IsPortAvailable(port int) bool {
 }
 
 // GetPort gets a free TCP port between 1024-65535.
+// Ports released by Release are reused first, the latest one first.
 func GetPort() (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	for len(released) > 0 {
+		p := released[len(released)-1]
+		released = released[:len(released)-1]
+		if IsPortAvailable(p) {
+			return p, nil
+		}
+	}
 	for i := previousPort; i < maxPort; i++ {
 		if IsPortAvailable(i) {
 			// Next previousPort is 1124 if i == 1024 now.
@@ -38,3 +53,10 @@ func GetPort() (int, error) {
 	}
 	return -1, errors.New("Not found free TCP Port")
 }
+
+// Release releases the port got by GetPort to be reused.
+func Release(port int) {
+	mu.Lock()
+	released = append(released, port)
+	mu.Unlock()
+}
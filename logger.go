@@ -3,6 +3,7 @@ package golet
 import (
 	"fmt"
 	"io"
+	"sync"
 	"time"
 )
 
@@ -11,13 +12,15 @@ type Logger struct {
 	enableColor bool
 	out         io.Writer
 	sid         string
+	tag         string
 	clr         color
+	tap         *logTap
 }
 
 // Improved io.writer for golet
 func (l *Logger) Write(data []byte) (n int, err error) {
 	ln := len(data)
-	if l.enable {
+	if l.enable || l.tap.active() {
 		startPos := 0
 		for i := 0; i < ln; i++ {
 			if data[i] == '\n' {
@@ -31,6 +34,10 @@ func (l *Logger) Write(data []byte) (n int, err error) {
 }
 
 func (l *Logger) write(data []byte) (n int, err error) {
+	l.tap.send(l.sid, l.tag, data)
+	if !l.enable {
+		return len(data), nil
+	}
 	hour, min, sec := time.Now().Clock()
 	if l.enableColor {
 		return l.out.Write([]byte(fmt.Sprintf(
@@ -42,3 +49,54 @@ func (l *Logger) write(data []byte) (n int, err error) {
 	}
 	return l.out.Write([]byte(fmt.Sprintf("%02d:%02d:%02d %-10s | %s", hour, min, sec, l.sid, data)))
 }
+
+// logTap delivers lines of logs of workers to subscribers like the control API.
+type logTap struct {
+	mu   sync.Mutex
+	subs map[chan []byte]string // subscriber and the ID or tag of workers it receives.
+}
+
+func (t *logTap) active() bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.subs) > 0
+}
+
+// subscribe returns a channel to receive lines of logs of workers whose ID or tag is name.
+// Lines are dropped if the subscriber does not keep up with them.
+func (t *logTap) subscribe(name string) chan []byte {
+	ch := make(chan []byte, 256)
+	t.mu.Lock()
+	if t.subs == nil {
+		t.subs = map[chan []byte]string{}
+	}
+	t.subs[ch] = name
+	t.mu.Unlock()
+	return ch
+}
+
+func (t *logTap) unsubscribe(ch chan []byte) {
+	t.mu.Lock()
+	delete(t.subs, ch)
+	t.mu.Unlock()
+}
+
+func (t *logTap) send(sid, tag string, data []byte) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for ch, name := range t.subs {
+		if name != sid && name != tag {
+			continue
+		}
+		select {
+		case ch <- []byte(fmt.Sprintf("%-10s | %s", sid, data)):
+		default:
+		}
+	}
+}
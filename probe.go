@@ -0,0 +1,199 @@
+package golet
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Default values of Probe.
+const (
+	defaultProbeInterval = time.Second
+	defaultProbeTimeout  = time.Second
+	defaultReadyTimeout  = 30 * time.Second
+	defaultFailures      = 3
+)
+
+// Probe checks whether a service is healthy.
+// If several checks are set, all of them must succeed.
+type Probe struct {
+	TCP    bool   // Connect to the assigned port.
+	HTTP   string // URL to GET. "$PORT" is replaced. If it starts with "/", GET it from the assigned port. 2xx or 3xx is healthy.
+	Exec   string // Command to run. "$PORT" is replaced. Exit status 0 is healthy.
+	Notify bool   // Wait until the callback calls Context.Ready. This is for readiness of callbacks.
+	// Go function. nil error is healthy. It receives *golet.Context of the worker.
+	Func func(context.Context) error
+
+	Interval         time.Duration // Interval between checks. 1s by default.
+	Timeout          time.Duration // Timeout of each check. 1s by default.
+	FailureThreshold int           // Number of consecutive failures to restart the service. This is for liveness. 3 by default.
+}
+
+// enabled reports whether the probe has something to check.
+func (p Probe) enabled() bool {
+	return p.TCP || p.HTTP != "" || p.Exec != "" || p.Notify || p.Func != nil
+}
+
+func (p Probe) interval() time.Duration {
+	if p.Interval <= 0 {
+		return defaultProbeInterval
+	}
+	return p.Interval
+}
+
+func (p Probe) failureThreshold() int {
+	if p.FailureThreshold <= 0 {
+		return defaultFailures
+	}
+	return p.FailureThreshold
+}
+
+func (p Probe) timeout() time.Duration {
+	if p.Timeout <= 0 {
+		return defaultProbeTimeout
+	}
+	return p.Timeout
+}
+
+// check runs checks of the probe against the service.
+func (p Probe) check(service Service) error {
+	port := service.ctx.Port()
+	if p.TCP {
+		conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), p.timeout())
+		if err != nil {
+			return err
+		}
+		conn.Close()
+	}
+	if p.HTTP != "" {
+		url := strings.Replace(p.HTTP, "$PORT", fmt.Sprintf("%d", port), -1)
+		if strings.HasPrefix(url, "/") {
+			url = fmt.Sprintf("http://127.0.0.1:%d%s", port, url)
+		}
+		client := &http.Client{Timeout: p.timeout()}
+		resp, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || 400 <= resp.StatusCode {
+			return fmt.Errorf("GET %s: %s", url, resp.Status)
+		}
+	}
+	if p.Exec != "" {
+		cmd := service.command(p.Exec)
+		cmd.Stdout, cmd.Stderr = nil, nil
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		// Kill the process group of the command when it timed out.
+		t := time.AfterFunc(p.timeout(), func() {
+			signalProcGroup(cmd.Process, syscall.SIGKILL)
+		})
+		defer t.Stop()
+		if err := cmd.Wait(); err != nil {
+			return fmt.Errorf("%s: %s", p.Exec, err)
+		}
+	}
+	if p.Func != nil {
+		errc := make(chan error, 1)
+		go func() { errc <- p.Func(service.ctx) }()
+		t := time.NewTimer(p.timeout())
+		defer t.Stop()
+		select {
+		case err := <-errc:
+			return err
+		case <-t.C:
+			return fmt.Errorf("function did not return in %s", p.timeout())
+		}
+	}
+	return nil
+}
+
+// probeReady marks the worker ready when the readiness probe succeeds.
+// It stops probing when done is closed.
+func (c *config) probeReady(service Service, done <-chan struct{}) {
+	p := service.Readiness
+	if p.Notify {
+		// Wait for Context.Ready.
+		return
+	}
+	if !p.enabled() {
+		service.state.markReady()
+		return
+	}
+	go func() {
+		t := time.NewTicker(p.interval())
+		defer t.Stop()
+		for {
+			if p.check(service) == nil {
+				service.state.markReady()
+				return
+			}
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+// probeLive checks the liveness of the worker periodically after it is ready.
+// If checks fail FailureThreshold times in a row, golet restarts the worker.
+// It stops probing when done is closed.
+func (c *config) probeLive(service Service, done <-chan struct{}) {
+	p := service.Liveness
+	if !p.enabled() {
+		return
+	}
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-service.state.readyChan():
+		}
+		t := time.NewTicker(p.interval())
+		defer t.Stop()
+		failures := 0
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+			err := p.check(service)
+			if err == nil {
+				failures = 0
+				continue
+			}
+			failures++
+			if failures >= p.failureThreshold() {
+				service.ctx.Printf("Liveness probe failed %d times: %s\n", failures, err.Error())
+				c.restartWorker(service)
+				return
+			}
+		}
+	}()
+}
+
+// waitReady waits for the worker to be ready.
+func (c *config) waitReady(service Service) {
+	timeout := service.ReadyTimeout
+	if timeout <= 0 {
+		timeout = defaultReadyTimeout
+	}
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-service.state.readyChan():
+	case <-service.state.finishedChan():
+	case <-c.stop:
+	case <-t.C:
+		service.ctx.Printf("Not ready in %s\n", timeout)
+	}
+}
@@ -0,0 +1,37 @@
+//go:build !windows
+// +build !windows
+
+package golet
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcGroup starts the command in its own process group.
+// So that golet can send signals to its grandchildren too.
+func setProcGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalProcGroup sends the signal to the process group led by p.
+// If p is not a process group leader, sends the signal to p only.
+func signalProcGroup(p *os.Process, sig syscall.Signal) error {
+	if err := syscall.Kill(-p.Pid, sig); err != syscall.ESRCH {
+		return err
+	}
+	return p.Signal(sig)
+}
+
+// trapSignals are signals golet traps.
+var trapSignals = []os.Signal{
+	syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT,
+	syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGWINCH,
+}
+
+// signalNames are names of signals for ParseSignal.
+var signalNames = map[string]syscall.Signal{
+	"HUP": syscall.SIGHUP, "INT": syscall.SIGINT, "QUIT": syscall.SIGQUIT, "KILL": syscall.SIGKILL, "TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1, "USR2": syscall.SIGUSR2, "WINCH": syscall.SIGWINCH,
+}
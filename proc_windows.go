@@ -0,0 +1,28 @@
+//go:build windows
+// +build windows
+
+package golet
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcGroup does nothing on windows.
+func setProcGroup(cmd *exec.Cmd) {}
+
+// signalProcGroup sends the signal to p only, because windows does not have process groups.
+func signalProcGroup(p *os.Process, sig syscall.Signal) error {
+	return p.Signal(sig)
+}
+
+// trapSignals are signals golet traps.
+var trapSignals = []os.Signal{
+	syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT,
+}
+
+// signalNames are names of signals for ParseSignal.
+var signalNames = map[string]syscall.Signal{
+	"HUP": syscall.SIGHUP, "INT": syscall.SIGINT, "QUIT": syscall.SIGQUIT, "KILL": syscall.SIGKILL, "TERM": syscall.SIGTERM,
+}
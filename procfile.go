@@ -0,0 +1,134 @@
+package golet
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var procfileLine = regexp.MustCompile(`^([A-Za-z0-9_-]+):\s*(.*)$`)
+
+// ProcfileError is the error of parsing a Procfile.
+type ProcfileError struct {
+	File string // Name of the file. Empty if the Procfile is not read from a file.
+	Line int    // Line number where the error occurred.
+	Msg  string
+}
+
+func (e *ProcfileError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// LoadProcfile reads services from the Procfile at path.
+func LoadProcfile(path string) ([]Service, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	services, err := ParseProcfile(f)
+	if perr, ok := err.(*ProcfileError); ok {
+		perr.File = path
+	}
+	return services, err
+}
+
+// ParseProcfile parses services from a Procfile compatible with foreman.
+// Each line is like "name: command", and the name is used as Tag of the service.
+// Blank lines and lines starting with "#" are ignored.
+func ParseProcfile(r io.Reader) ([]Service, error) {
+	var services []Service
+	seen := map[string]int{}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		m := procfileLine.FindStringSubmatch(line)
+		if m == nil {
+			return nil, &ProcfileError{Line: n, Msg: fmt.Sprintf("invalid line: %q", line)}
+		}
+		name, command := m[1], strings.TrimSpace(m[2])
+		if command == "" {
+			return nil, &ProcfileError{Line: n, Msg: "missing command of " + name}
+		}
+		if prev, ok := seen[name]; ok {
+			return nil, &ProcfileError{Line: n, Msg: fmt.Sprintf("%s is already defined at line %d", name, prev)}
+		}
+		seen[name] = n
+		services = append(services, Service{Exec: command, Tag: name})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return services, nil
+}
+
+// Formation is the number of workers of each service like foreman's formation.
+// "all" sets the number of workers of services which are not listed.
+type Formation map[string]int
+
+// ParseFormation parses the formation like "web=2,worker=3" or "all=1,web=0".
+func ParseFormation(s string) (Formation, error) {
+	f := Formation{}
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid formation: %q", kv)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(kv[i+1:]))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid number of workers: %q", kv)
+		}
+		f[strings.TrimSpace(kv[:i])] = n
+	}
+	return f, nil
+}
+
+// Apply sets Worker of the services by the formation.
+// Services whose number of workers is 0 are removed.
+// It returns an error if the formation has a name which is not Tag of any service.
+func (f Formation) Apply(services []Service) ([]Service, error) {
+	tags := map[string]bool{}
+	for _, s := range services {
+		tags[s.Tag] = true
+	}
+	var unknown []string
+	for name := range f {
+		if name != "all" && !tags[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("formation: unknown service: %s", strings.Join(unknown, ", "))
+	}
+	applied := make([]Service, 0, len(services))
+	for _, s := range services {
+		n, ok := f[s.Tag]
+		if !ok {
+			n, ok = f["all"]
+		}
+		if ok {
+			if n == 0 {
+				continue
+			}
+			s.Worker = n
+		}
+		applied = append(applied, s)
+	}
+	return applied, nil
+}
@@ -0,0 +1,243 @@
+package golet
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// errNoConfig is returned by Reload when the Runner is not created by LoadConfig.
+var errNoConfig = errors.New("golet is not created by LoadConfig")
+
+// Reload re-reads the config file of the Runner created by LoadConfig, and applies changes of services.
+// Services are compared by tag. New services are started, removed services are stopped,
+// and services whose definitions or environment variables changed are restarted with new definitions.
+// Other services keep running. Options of the runner other than env and env_file are not reloaded,
+// and services added by Add are left untouched.
+// golet calls it when it receives SIGHUP. If the file has an error, nothing is changed.
+func (c *config) Reload() error {
+	if c.configPath == "" {
+		return errNoConfig
+	}
+	c.changeMu.Lock()
+	defer c.changeMu.Unlock()
+
+	// Decode into a bare config not to change options of the running one.
+	next := &config{}
+	defs, err := decodeConfig(c.configPath, next)
+	if err != nil {
+		return err
+	}
+	envs := map[string]map[string]string{}
+	for i := range defs {
+		key := fmt.Sprintf("services[%d]", i)
+		if err := defs[i].Validate(); err != nil {
+			return &ConfigError{File: c.configPath, Key: key, Msg: err.Error()}
+		}
+		if defs[i].Worker <= 0 {
+			defs[i].Worker = 1
+		}
+		if _, ok := envs[defs[i].Tag]; ok {
+			return &ConfigError{File: c.configPath, Key: key, Msg: "tag: " + defs[i].Tag + " is already exists"}
+		}
+		env, err := next.serviceEnv(defs[i])
+		if err != nil {
+			return &ConfigError{File: c.configPath, Key: key, Msg: err.Error()}
+		}
+		envs[defs[i].Tag] = env
+	}
+
+	if err := c.holdRunning(); err != nil {
+		return err
+	}
+	defer c.leave()
+
+	current := c.serviceList()
+	running := map[string]Service{}
+	for _, s := range current {
+		if !c.configTags[s.Tag] {
+			if _, ok := envs[s.Tag]; ok {
+				return &ConfigError{File: c.configPath, Msg: "tag: " + s.Tag + " is already exists"}
+			}
+			continue
+		}
+		if _, ok := running[s.Tag]; !ok {
+			running[s.Tag] = s
+		}
+	}
+
+	var added, changed, removed []string
+	stale := map[string]bool{}
+	for tag := range running {
+		if _, ok := envs[tag]; !ok {
+			removed = append(removed, tag)
+			stale[tag] = true
+		}
+	}
+	var workers []Service
+	for _, def := range defs {
+		if s, ok := running[def.Tag]; !ok {
+			added = append(added, def.Tag)
+		} else if !sameService(s, def, envs[def.Tag]) {
+			changed = append(changed, def.Tag)
+			stale[def.Tag] = true
+		} else {
+			continue
+		}
+		c.serviceNum++
+		w, err := c.newWorkers(def, envs[def.Tag])
+		if err != nil {
+			releasePorts(workers, true)
+			return err
+		}
+		workers = append(workers, w...)
+	}
+	var list, stopped []Service
+	for _, s := range current {
+		if stale[s.Tag] {
+			stopped = append(stopped, s)
+		} else {
+			list = append(list, s)
+		}
+	}
+	services, err := sortServices(append(list, workers...))
+	if err != nil {
+		releasePorts(workers, true)
+		return &ConfigError{File: c.configPath, Msg: err.Error()}
+	}
+	for _, tag := range removed {
+		delete(c.tags, tag)
+		delete(c.configTags, tag)
+	}
+	for _, tag := range added {
+		c.tags[tag] = struct{}{}
+		c.configTags[tag] = true
+	}
+	c.env = next.env
+	c.apply(services, stopped, workers)
+	releasePorts(stopped, true)
+
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(removed)
+	c.logf("Reload: added [%s], changed [%s], removed [%s]\n",
+		strings.Join(added, " "), strings.Join(changed, " "), strings.Join(removed, " "))
+	return nil
+}
+
+// apply stops stale workers in reverse order of dependencies, and replaces workers of golet with services.
+// Jobs of stale cron workers are removed from cron. Then it launches fresh workers in order of dependencies.
+func (c *config) apply(services, stale, fresh []Service) {
+	stopping := map[*workerState]bool{}
+	for _, s := range stale {
+		stopping[s.state] = true
+	}
+	launching := map[*workerState]bool{}
+	for _, s := range fresh {
+		launching[s.state] = true
+	}
+	current := c.serviceList()
+	for i := len(current) - 1; i >= 0; {
+		// Workers of the same service are stopped together.
+		tag := current[i].Tag
+		var wg sync.WaitGroup
+		for ; i >= 0 && current[i].Tag == tag; i-- {
+			if stopping[current[i].state] {
+				wg.Add(1)
+				go func(s Service) {
+					defer wg.Done()
+					c.retire(s)
+				}(current[i])
+			}
+		}
+		wg.Wait()
+	}
+	for _, s := range stale {
+		if s.isCron() {
+			c.removeJobs()
+			break
+		}
+	}
+
+	c.servicesMu.Lock()
+	c.services = services
+	c.servicesMu.Unlock()
+
+	for _, s := range services {
+		if !launching[s.state] {
+			continue
+		}
+		if c.stopping() {
+			// Let shutdown know it does not run.
+			s.state.exited()
+			continue
+		}
+		c.launch(s)
+	}
+}
+
+// holdRunning keeps golet running while services are replaced, even if all of them are stopped.
+// It waits for golet to launch services added before Start. Call leave after replacing them.
+func (c *config) holdRunning() error {
+	c.mu.Lock()
+	started := c.started
+	c.mu.Unlock()
+	if !started {
+		return errNotRunning
+	}
+	select {
+	case <-c.launched:
+	case <-c.stop:
+		return errNotRunning
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.finished || c.stopping() {
+		return errNotRunning
+	}
+	c.active++
+	return nil
+}
+
+// reloadBySignal reloads the config file, and logs the error if it failed.
+func (c *config) reloadBySignal() {
+	if err := c.Reload(); err != nil {
+		c.logf("Reload Error: %s\n", err)
+	}
+}
+
+// retire stops the worker removed from golet, and waits for it to finish.
+// The worker is never restarted.
+func (c *config) retire(service Service) {
+	service.state.retire()
+	sig, _ := c.signalFor(service, syscall.SIGTERM)
+	c.stopWorker(service, sig)
+	if service.isCron() {
+		service.state.set(StateStopped)
+	}
+}
+
+// sameService reports whether the running worker has the same definition and environment variables as service.
+func sameService(running, service Service, env map[string]string) bool {
+	if !reflect.DeepEqual(running.ctx.env, env) {
+		return false
+	}
+	running.id, running.ctx, running.logger, running.state, running.basePort = "", nil, nil, nil, 0
+	return reflect.DeepEqual(running, service)
+}
+
+// logf writes the message of golet itself to the log.
+func (c *config) logf(format string, a ...interface{}) {
+	l := &Logger{
+		enable:      c.logWorker,
+		enableColor: c.color,
+		out:         c.logger,
+		sid:         "golet",
+		clr:         color(red + 31),
+	}
+	fmt.Fprintf(l, format, a...)
+}
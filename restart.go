@@ -0,0 +1,118 @@
+package golet
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+)
+
+const defaultRetryWindow = time.Minute
+
+// RestartPolicy decides whether a service is restarted after it exits.
+type RestartPolicy int
+
+const (
+	// RestartOnFailure restarts the service when the command exits with non-zero status
+	// or the callback returns an error, unless golet has sent a signal to the service.
+	// This is the default.
+	RestartOnFailure RestartPolicy = iota
+	// RestartAlways restarts the service whenever it exits, even if the exit was
+	// caused by a signal sent from golet, e.g. a forwarded one. Only golet's own stop,
+	// remove and hold end it: stopping all services, Remove, Scale down and stop by the control API.
+	RestartAlways
+	// RestartUnlessStopped restarts the service whenever it exits,
+	// unless golet has sent a signal to the service.
+	RestartUnlessStopped
+	// RestartNever never restarts the service.
+	RestartNever
+)
+
+// String returns the name of the restart policy.
+func (p RestartPolicy) String() string {
+	switch p {
+	case RestartOnFailure:
+		return "on-failure"
+	case RestartAlways:
+		return "always"
+	case RestartUnlessStopped:
+		return "unless-stopped"
+	case RestartNever:
+		return "never"
+	}
+	return "unknown"
+}
+
+// ParseRestartPolicy returns the restart policy of the name like "on-failure".
+func ParseRestartPolicy(name string) (RestartPolicy, error) {
+	for _, p := range []RestartPolicy{RestartOnFailure, RestartAlways, RestartUnlessStopped, RestartNever} {
+		if p.String() == name {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown restart policy: %q", name)
+}
+
+// shouldRestart reports whether the service should be restarted.
+// err is the result of the command or callback, and stopped is true
+// if golet has sent a signal to the service while it was running.
+func (p RestartPolicy) shouldRestart(err error, stopped bool) bool {
+	switch p {
+	case RestartAlways:
+		return true
+	case RestartUnlessStopped:
+		return !stopped
+	case RestartNever:
+		return false
+	}
+	return err != nil && !stopped
+}
+
+// restartWorker stops the current run of the worker, and restarts it regardless of the restart policy.
+// The command is sent the stop signal, and the context of the callback is canceled.
+func (c *config) restartWorker(service Service) {
+	done := service.state.requestRestart()
+	if done == nil {
+		return
+	}
+	c.preStop(service)
+	if !service.isCode() {
+		sig, _ := c.signalFor(service, syscall.SIGTERM)
+		// The command may not have started yet, e.g. the worker without readiness probe has just restarted.
+		for _, p := range service.state.stopRun(sig) {
+			signalProcGroup(p, sig)
+		}
+	}
+	c.waitStop(service, done)
+}
+
+// willRestart reports whether the worker restarts after the run.
+// requested is true if the restart was requested by restartWorker. Such restarts are not counted toward StartRetries,
+// because the worker did not crash.
+func (c *config) willRestart(service Service, err error, stopped, requested bool) bool {
+	if c.stopping() || c.ctx.Err() != nil {
+		return false
+	}
+	if requested {
+		service.state.restartedByRequest()
+		return true
+	}
+	return service.Restart.shouldRestart(err, stopped) && c.canRestart(service)
+}
+
+// canRestart records a restart of the service, and reports whether the service can restart.
+// If the service restarts too many times, golet gives up and marks it FATAL.
+func (c *config) canRestart(service Service) bool {
+	window := service.RetryWindow
+	if window <= 0 {
+		window = defaultRetryWindow
+	}
+	if !service.state.restarted(time.Now(), service.StartRetries, window) {
+		return true
+	}
+	service.state.set(StateFatal)
+	service.ctx.Printf("Entered FATAL state: restarted more than %d times within %s\n", service.StartRetries, window)
+	if c.exitOnFatal {
+		c.stopAll(fmt.Errorf("%s: entered FATAL state", service.id))
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package golet
+
+import (
+	"errors"
+	"fmt"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// SetRollingRestartSignal can specify the signal to restart workers of all services one after another by RollingRestart.
+// If you do not set, golet handles the signal as usual. e.g. SIGUSR2 is sent to services which map it in Signals.
+func (c *config) SetRollingRestartSignal(sig syscall.Signal) {
+	c.rollingSignal = sig
+	signal.Notify(c.ctx.sigchan, sig)
+}
+
+// RollingRestart restarts workers of the service specified by tag without stopping all of them at once.
+// It restarts MaxUnavailable workers at a time, and waits for them to be ready before restarting the next ones.
+// If a worker is not ready within StopTimeout and ReadyTimeout, it gives up restarting the rest and returns an error.
+// Cron services cannot be restarted by it.
+func (c *config) RollingRestart(tag string) error {
+	c.changeMu.Lock()
+	defer c.changeMu.Unlock()
+	if err := c.holdRunning(); err != nil {
+		return err
+	}
+	defer c.leave()
+
+	var workers []Service
+	for _, service := range c.serviceList() {
+		if service.Tag == tag {
+			workers = append(workers, service)
+		}
+	}
+	if len(workers) == 0 {
+		return errors.New("tag: " + tag + " does not exist")
+	}
+	if workers[0].isCron() {
+		return errors.New("tag: " + tag + " is a cron service")
+	}
+	max := workers[0].MaxUnavailable
+	if max <= 0 {
+		max = 1
+	}
+	c.logf("Rolling restart: %s\n", tag)
+	for i := 0; i < len(workers); i += max {
+		batch := workers[i:]
+		if len(batch) > max {
+			batch = batch[:max]
+		}
+		errs := make([]error, len(batch))
+		var wg sync.WaitGroup
+		for j, service := range batch {
+			wg.Add(1)
+			go func(j int, service Service) {
+				defer wg.Done()
+				errs[j] = c.rollWorker(service)
+			}(j, service)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rollWorker restarts the worker, and waits for the new run to be ready.
+// It gives up if the worker is not ready within StopTimeout and ReadyTimeout,
+// e.g. the callback does not return after its context is canceled.
+func (c *config) rollWorker(service Service) error {
+	stopTimeout := service.StopTimeout
+	if stopTimeout <= 0 {
+		stopTimeout = defaultStopTimeout
+	}
+	readyTimeout := service.ReadyTimeout
+	if readyTimeout <= 0 {
+		readyTimeout = defaultReadyTimeout
+	}
+	t := time.NewTimer(stopTimeout + readyTimeout)
+	defer t.Stop()
+
+	next := service.state.nextRun()
+	if err := c.restartByControl(service); err != nil {
+		return err
+	}
+	select {
+	case <-next:
+	case <-service.state.finishedChan():
+		return fmt.Errorf("%s finished before it is ready", service.id)
+	case <-c.stop:
+		return errNotRunning
+	case <-t.C:
+		return fmt.Errorf("%s did not restart in %s", service.id, stopTimeout+readyTimeout)
+	}
+	select {
+	case <-service.state.readyChan():
+		return nil
+	case <-service.state.finishedChan():
+		return fmt.Errorf("%s finished before it is ready", service.id)
+	case <-c.stop:
+		return errNotRunning
+	case <-t.C:
+		return fmt.Errorf("%s is not ready in %s", service.id, stopTimeout+readyTimeout)
+	}
+}
+
+// rollingRestartAll restarts all services except cron services by RollingRestart in order of dependencies.
+func (c *config) rollingRestartAll() {
+	seen := map[string]bool{}
+	for _, service := range c.serviceList() {
+		if seen[service.Tag] || service.isCron() {
+			continue
+		}
+		seen[service.Tag] = true
+		if err := c.RollingRestart(service.Tag); err != nil {
+			c.logf("Rolling Restart Error: %s\n", err)
+			return
+		}
+	}
+}
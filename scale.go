@@ -0,0 +1,84 @@
+package golet
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Code-Hex/golet/internal/port"
+)
+
+// Scale changes the number of workers of the service specified by tag to n.
+// New workers get IDs following existing ones like "tag.2", and ports following the port of the first worker
+// if they are available. They are launched immediately if golet is running.
+// If n is less than the current number, the highest-numbered workers are stopped gracefully.
+// It works for Exec, Code and cron services alike.
+func (c *config) Scale(tag string, n int) error {
+	if n < 1 || n > maxWorkers {
+		return fmt.Errorf("invalid number of workers: %d (1-%d)", n, maxWorkers)
+	}
+	c.mu.Lock()
+	started := c.started
+	c.mu.Unlock()
+	if started {
+		c.changeMu.Lock()
+		defer c.changeMu.Unlock()
+		if err := c.holdRunning(); err != nil {
+			return err
+		}
+		defer c.leave()
+	}
+
+	current := c.serviceList()
+	var workers []Service
+	for _, s := range current {
+		if s.Tag == tag {
+			workers = append(workers, s)
+		}
+	}
+	if len(workers) == 0 {
+		return errors.New("tag: " + tag + " does not exist")
+	}
+	var fresh, stale []Service
+	first := workers[0]
+	first.Worker = n
+	for i := len(workers); i < n; i++ {
+		p := first.basePort + i
+		if !port.IsPortAvailable(p) {
+			var err error
+			if p, err = port.GetPort(); err != nil {
+				releasePorts(fresh, false)
+				return err
+			}
+		}
+		fresh = append(fresh, c.newWorker(first, first.ctx.env, i, p, first.ctx.logger.clr))
+	}
+	if n < len(workers) {
+		stale = workers[n:]
+	}
+
+	// Keep workers of the service together in order of their numbers.
+	list := make([]Service, 0, len(current)-len(stale)+len(fresh))
+	i := 0
+	for _, s := range current {
+		if s.Tag != tag {
+			list = append(list, s)
+			continue
+		}
+		if i < n {
+			s.Worker = n
+			list = append(list, s)
+		}
+		if i++; i == len(workers) {
+			list = append(list, fresh...)
+		}
+	}
+	if started {
+		c.apply(list, stale, fresh)
+	} else {
+		c.servicesMu.Lock()
+		c.services = list
+		c.servicesMu.Unlock()
+	}
+	releasePorts(stale, false)
+	return nil
+}
@@ -6,19 +6,57 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"syscall"
+	"time"
 )
 
+// maxWorkers is the maximum number of workers of a service.
+const maxWorkers = 100
+
 // Service struct to add services to golet.
 type Service struct {
 	Exec   string
 	Code   func(context.Context) error // Routine of services.
-	Worker int                         // Number of goroutine. The maximum number of workers is 100.
+	Worker int                         // Number of goroutine. 1 by default. The maximum number of workers is 100.
 	Tag    string                      // Keyword for log.
 	Every  string                      // Crontab like format. See https://godoc.org/github.com/robfig/cron#hdr-CRON_Expression_Format
 
-	id     string
-	ctx    *Context // This can be io.Writer. see context.go
-	logger *Logger
+	Env     map[string]string // Environment variables of the service. They do not change the environment of the process.
+	EnvFile []string          // Dotenv files loaded as environment variables of the service. Env takes priority over them.
+	Dir     string            // Working directory of the command. The current directory by default.
+
+	DependsOn []string // Tags of services to start before this service. This service is stopped before them.
+	Critical  bool     // Stop all services when a worker of this service finished and is not restarted. Not for cron services.
+
+	Restart RestartPolicy // When to restart the service. RestartOnFailure by default.
+	Backoff Backoff       // Delay between restarts.
+
+	StartRetries int           // Give up restarting if the service restarts more than this within RetryWindow. 0 means unlimited.
+	RetryWindow  time.Duration // Window for StartRetries. 1 minute by default.
+
+	StopTimeout time.Duration  // Send SIGKILL if the service does not exit within this after golet sent the stop signal. 10s by default.
+	StopSignal  syscall.Signal // Signal to send when golet stops the service. The signal golet received by default.
+	// MaxUnavailable is the number of workers RollingRestart restarts at a time. 1 by default.
+	MaxUnavailable int
+	// Signals translates the signal golet received to the signal sent to the command.
+	// e.g. {syscall.SIGUSR2: syscall.SIGQUIT}
+	// SIGUSR1, SIGUSR2 and SIGWINCH are sent only if they are in this table.
+	Signals map[syscall.Signal]syscall.Signal
+
+	Readiness    Probe         // Probe to check the service is ready. Dependent services wait for it.
+	ReadyTimeout time.Duration // Timeout to wait for the service to be ready. 30s by default.
+	Liveness     Probe         // Probe to check the service is alive. golet restarts the service if it fails.
+
+	PreStart  Hook // Run before each start. If it fails, the service is not started and may be restarted.
+	PostStart Hook // Run after the command started or the callback is called.
+	PreStop   Hook // Run before golet sends the stop signal to the service.
+	PostStop  Hook // Run after the command exited or the callback returned.
+
+	id       string
+	ctx      *Context // This can be io.Writer. see context.go
+	logger   *Logger
+	state    *workerState
+	basePort int // port of the first worker. Ports of workers are allocated from it.
 }
 
 func (s *Service) createContext(ctx *signalCtx, logger *Logger, port int) error {
@@ -26,18 +64,28 @@ func (s *Service) createContext(ctx *signalCtx, logger *Logger, port int) error
 		ctx:    ctx,
 		logger: logger,
 		port:   port,
+		state:  s.state,
 	}
 	return nil
 }
 
 // Create a command
 func (s *Service) prepare() *exec.Cmd {
-	c := strings.Replace(s.Exec, "$PORT", fmt.Sprintf("%d", s.ctx.Port()), -1)
+	return s.command(s.Exec)
+}
+
+// command creates a command of the line through the shell.
+// "$PORT" in the line is replaced with the assigned port.
+func (s *Service) command(line string) *exec.Cmd {
+	c := strings.Replace(line, "$PORT", fmt.Sprintf("%d", s.ctx.Port()), -1)
 	args := append(shell, c)
 	cmd := exec.Command(args[0], args[1:]...)
 	cmd.Stdout = s.ctx
 	cmd.Stderr = s.ctx
-	cmd.Env = append(os.Environ(), fmt.Sprintf("PORT=%d", s.ctx.Port()))
+	cmd.Env = append(os.Environ(), environ(s.ctx.env)...)
+	cmd.Env = append(cmd.Env, fmt.Sprintf("PORT=%d", s.ctx.Port()))
+	cmd.Dir = s.Dir
+	setProcGroup(cmd)
 	return cmd
 }
 
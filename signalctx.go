@@ -16,12 +16,18 @@ type signalCtx struct {
 }
 
 func (s *signalCtx) notifySignal() {
+	s.mu.Lock()
 	if s.recv != nil {
-		s.mu.Lock()
 		close(s.recv) // Notify that signals has been received
 		s.recv = make(chan struct{})
-		s.mu.Unlock()
 	}
+	s.mu.Unlock()
+}
+
+func (s *signalCtx) setSignal(sig os.Signal) {
+	s.mu.Lock()
+	s.signal = sig
+	s.mu.Unlock()
 }
 
 // Recv send channel when a process receives a signal
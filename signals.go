@@ -0,0 +1,85 @@
+package golet
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// ParseSignal returns the signal of the name like "TERM" or "SIGTERM".
+func ParseSignal(name string) (syscall.Signal, error) {
+	if sig, ok := signalNames[strings.TrimPrefix(strings.ToUpper(name), "SIG")]; ok {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("unknown signal: %q", name)
+}
+
+// isStopSignal reports whether golet stops all services when it receives sig.
+func isStopSignal(sig os.Signal) bool {
+	switch sig {
+	case syscall.SIGTERM, syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT:
+		return true
+	}
+	return false
+}
+
+// signalFor returns the signal to send to the service when golet received sig.
+// If sig is nil, it means context cancel. It returns false if golet should not send any signal.
+func (c *config) signalFor(service Service, sig os.Signal) (syscall.Signal, bool) {
+	if sig == nil {
+		if c.cancelSignal < 0 {
+			return 0, false
+		}
+		if service.StopSignal != 0 {
+			return service.StopSignal, true
+		}
+		return c.cancelSignal, true
+	}
+	if s, ok := sig.(syscall.Signal); ok {
+		if forward, ok := service.Signals[s]; ok {
+			return forward, true
+		}
+	}
+	if !isStopSignal(sig) {
+		return 0, false
+	}
+	if service.StopSignal != 0 {
+		return service.StopSignal, true
+	}
+	switch sig {
+	case syscall.SIGINT:
+		return syscall.SIGINT, true
+	case syscall.SIGQUIT:
+		return syscall.SIGQUIT, true
+	}
+	return syscall.SIGTERM, true
+}
+
+// forwardSignal sends the signal golet received to services which map it in Signals.
+// Workers are not regarded as stopped by golet even if the signal makes them exit.
+func (c *config) forwardSignal(sig os.Signal) {
+	c.ctx.notifySignal()
+	for _, service := range c.serviceList() {
+		if s, ok := c.signalFor(service, sig); ok {
+			signalWorker(service, s)
+		}
+	}
+}
+
+// notifySignal notifies callbacks that golet received a signal to stop them.
+func (c *config) notifySignal() {
+	for _, service := range c.serviceList() {
+		if service.isCode() {
+			service.state.signaled()
+		}
+	}
+	c.ctx.notifySignal()
+}
+
+// signalWorker sends the signal to the processes of the worker.
+func signalWorker(service Service, sig syscall.Signal) {
+	for _, p := range service.state.processes() {
+		signalProcGroup(p, sig)
+	}
+}
@@ -0,0 +1,448 @@
+package golet
+
+import (
+	"context"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// State represents the state of a worker.
+type State int
+
+const (
+	// StateStarting is the state until the worker starts running.
+	StateStarting State = iota
+	// StateRunning is the state while the worker is running.
+	StateRunning
+	// StateBackoff is the state while the worker is waiting to restart.
+	StateBackoff
+	// StateStopped is the state after the worker exited and will not restart.
+	StateStopped
+	// StateFatal is the state after golet gave up restarting the worker.
+	StateFatal
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case StateStarting:
+		return "STARTING"
+	case StateRunning:
+		return "RUNNING"
+	case StateBackoff:
+		return "BACKOFF"
+	case StateStopped:
+		return "STOPPED"
+	case StateFatal:
+		return "FATAL"
+	}
+	return "UNKNOWN"
+}
+
+// workerState is shared between copies of the Service for each worker.
+type workerState struct {
+	mu       sync.Mutex
+	state    State
+	restarts []time.Time              // times of recent restarts to detect crash loop.
+	signals  uint64                   // number of times golet has sent signals to the worker.
+	procs    map[*os.Process]struct{} // running processes of the worker.
+	finished chan struct{}            // closed when the worker does not run anymore.
+	ready    chan struct{}            // closed when the worker is ready.
+	isReady  bool
+	begun    chan struct{}  // closed when the next run begins.
+	held     chan struct{}  // closed when the worker stopped by the control API is released. nil if not held.
+	job      func()         // job of the cron service.
+	retired  chan struct{}  // closed when the service is removed from golet.
+	stopSig  syscall.Signal // signal golet sent to stop the worker for good. 0 if it is not stopped.
+
+	// for the current run of the worker.
+	cancel  context.CancelFunc // cancels the context of the callback.
+	runDone chan struct{}      // closed when the run finished.
+	restart bool               // restart is requested regardless of the restart policy.
+	runSig  syscall.Signal     // signal golet sent to stop the run. 0 if it is not sent.
+
+	// result of the last run.
+	err     error
+	stopped bool // golet sent a signal to the worker while running.
+
+	pid          int       // process ID of the latest command.
+	startedAt    time.Time // time the latest run started.
+	restartCount int       // number of restarts.
+}
+
+func newWorkerState() *workerState {
+	return &workerState{
+		procs:    map[*os.Process]struct{}{},
+		finished: make(chan struct{}),
+		ready:    make(chan struct{}),
+		retired:  make(chan struct{}),
+		begun:    make(chan struct{}),
+	}
+}
+
+func (w *workerState) get() State {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.state
+}
+
+func (w *workerState) set(s State) {
+	w.mu.Lock()
+	w.state = s
+	w.mu.Unlock()
+}
+
+// exited marks the worker stopped unless golet gave up restarting it.
+func (w *workerState) exited() {
+	w.mu.Lock()
+	if w.state != StateFatal {
+		w.state = StateStopped
+	}
+	close(w.finished)
+	w.mu.Unlock()
+}
+
+// finishedChan returns the channel which is closed when the worker does not run anymore.
+func (w *workerState) finishedChan() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.finished
+}
+
+// relaunch resets the finished worker to run it again.
+// It reports false if the worker is still running.
+func (w *workerState) relaunch() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.finished:
+	default:
+		return false
+	}
+	w.finished = make(chan struct{})
+	w.state = StateStarting
+	w.restarts = nil
+	return true
+}
+
+// hold keeps the worker stopped until it is released.
+// It returns the channel closed when the current run finished, or nil if the worker is not running.
+func (w *workerState) hold() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.finished:
+		return nil
+	default:
+	}
+	if w.held == nil {
+		w.held = make(chan struct{})
+	}
+	return w.runDone
+}
+
+// release releases the held worker. It reports false if the worker is not held.
+func (w *workerState) release() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.held == nil {
+		return false
+	}
+	close(w.held)
+	w.held = nil
+	return true
+}
+
+// holdChan returns the channel which is closed when the worker is released, or nil if it is not held.
+func (w *workerState) holdChan() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.held
+}
+
+// retire marks the worker removed from golet. It is never started again.
+func (w *workerState) retire() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.retired:
+	default:
+		close(w.retired)
+	}
+}
+
+// isRetired reports whether the worker is removed from golet.
+func (w *workerState) isRetired() bool {
+	select {
+	case <-w.retired:
+		return true
+	default:
+		return false
+	}
+}
+
+// retiredChan returns the channel which is closed when the worker is removed from golet.
+func (w *workerState) retiredChan() <-chan struct{} {
+	return w.retired
+}
+
+func (w *workerState) setJob(job func()) {
+	w.mu.Lock()
+	w.job = job
+	w.mu.Unlock()
+}
+
+func (w *workerState) cronJob() func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.job
+}
+
+// begin resets the readiness of the worker, and marks it starting.
+// It returns the context for the callback and the channel closed when the run finished.
+func (w *workerState) begin(parent context.Context) (context.Context, <-chan struct{}) {
+	ctx, cancel := context.WithCancel(parent)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.isReady {
+		w.ready = make(chan struct{})
+		w.isReady = false
+	}
+	close(w.begun)
+	w.begun = make(chan struct{})
+	w.state = StateStarting
+	w.startedAt = time.Now()
+	w.cancel = cancel
+	w.runDone = make(chan struct{})
+	w.restart = false
+	w.runSig = 0
+	if w.stopSig != 0 {
+		// golet stopped the worker before this run began.
+		cancel()
+	}
+	return ctx, w.runDone
+}
+
+// nextRun returns the channel which is closed when the next run of the worker begins.
+func (w *workerState) nextRun() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.begun
+}
+
+// end marks the end of the run, and reports whether a restart was requested during the run.
+func (w *workerState) end() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.cancel()
+	close(w.runDone)
+	return w.restart
+}
+
+// record records the result of the last run.
+func (w *workerState) record(err error, stopped bool) {
+	w.mu.Lock()
+	w.err = err
+	w.stopped = stopped
+	w.mu.Unlock()
+}
+
+// failure returns the error of the worker if it failed, otherwise nil.
+// The worker which golet sent a signal to is not failed.
+func (w *workerState) failure(id string) *ServiceError {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.state != StateFatal && (w.err == nil || w.stopped) {
+		return nil
+	}
+	return w.resultLocked(id)
+}
+
+// result returns the result of the last run of the worker as *ServiceError.
+func (w *workerState) result(id string) *ServiceError {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.resultLocked(id)
+}
+
+func (w *workerState) resultLocked(id string) *ServiceError {
+	code, sig := exitStatus(w.err)
+	return &ServiceError{
+		ID:       id,
+		State:    w.state,
+		ExitCode: code,
+		Signal:   sig,
+		Err:      w.err,
+	}
+}
+
+// cancelRun cancels the context of the current run of the callback.
+func (w *workerState) cancelRun() {
+	w.mu.Lock()
+	if w.cancel != nil {
+		w.cancel()
+	}
+	w.mu.Unlock()
+}
+
+// requestRestart requests restart of the current run, and cancels the context of the callback.
+// It returns the channel closed when the run finished, or nil if the worker is not running.
+func (w *workerState) requestRestart() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.runDone == nil {
+		return nil
+	}
+	w.restart = true
+	w.cancel()
+	return w.runDone
+}
+
+// markReady marks the worker ready and running.
+func (w *workerState) markReady() {
+	w.mu.Lock()
+	if !w.isReady {
+		close(w.ready)
+		w.isReady = true
+		w.state = StateRunning
+	}
+	w.mu.Unlock()
+}
+
+// readyChan returns the channel which is closed when the worker is ready.
+func (w *workerState) readyChan() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ready
+}
+
+func (w *workerState) signaled() {
+	w.mu.Lock()
+	w.signals++
+	w.mu.Unlock()
+}
+
+// signalCount returns the number of times golet has sent signals to the worker.
+// Compare it before and after running to know the worker was stopped by golet.
+func (w *workerState) signalCount() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.signals
+}
+
+func (w *workerState) addProc(p *os.Process) {
+	w.mu.Lock()
+	w.procs[p] = struct{}{}
+	w.pid = p.Pid
+	w.mu.Unlock()
+}
+
+// addCmdProc registers the process of the command of the worker.
+// If golet has already stopped the worker or the run, the process missed the signal, so it is sent at once.
+// Processes of hooks are registered by addProc not to stop PostStop hook.
+func (w *workerState) addCmdProc(p *os.Process) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.procs[p] = struct{}{}
+	w.pid = p.Pid
+	sig := w.stopSig
+	if sig == 0 {
+		sig = w.runSig
+	}
+	if sig != 0 {
+		signalProcGroup(p, sig)
+	}
+}
+
+// stopFor records the signal to stop the worker for good, and returns its running processes.
+// Processes registered after this are sent the signal by addCmdProc.
+func (w *workerState) stopFor(sig syscall.Signal) []*os.Process {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopSig = sig
+	w.signals++
+	return w.processesLocked()
+}
+
+// stopRun records the signal to stop the current run of the worker, and returns its running processes.
+// The process of the command registered after this in the run is sent the signal by addCmdProc.
+func (w *workerState) stopRun(sig syscall.Signal) []*os.Process {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.runSig = sig
+	w.signals++
+	return w.processesLocked()
+}
+
+func (w *workerState) removeProc(p *os.Process) {
+	w.mu.Lock()
+	delete(w.procs, p)
+	if w.pid == p.Pid {
+		w.pid = 0
+	}
+	w.mu.Unlock()
+}
+
+// started records the time a run started.
+func (w *workerState) started(t time.Time) {
+	w.mu.Lock()
+	w.startedAt = t
+	w.mu.Unlock()
+}
+
+// status returns the status of the worker. Fields of the service are not set.
+func (w *workerState) status() ServiceStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	code, _ := exitStatus(w.err)
+	return ServiceStatus{
+		State:     w.state,
+		PID:       w.pid,
+		StartedAt: w.startedAt,
+		Restarts:  w.restartCount,
+		ExitCode:  code,
+		Err:       w.err,
+	}
+}
+
+// processes returns running processes of the worker.
+func (w *workerState) processes() []*os.Process {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.processesLocked()
+}
+
+func (w *workerState) processesLocked() []*os.Process {
+	procs := make([]*os.Process, 0, len(w.procs))
+	for p := range w.procs {
+		procs = append(procs, p)
+	}
+	return procs
+}
+
+// restartedByRequest records a restart requested by golet, which does not count toward the crash loop.
+func (w *workerState) restartedByRequest() {
+	w.mu.Lock()
+	w.restartCount++
+	w.mu.Unlock()
+}
+
+// restarted records a restart at now, and reports whether the worker
+// restarted more than max times within window.
+func (w *workerState) restarted(now time.Time, max int, window time.Duration) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.restartCount++
+	if max <= 0 {
+		return false
+	}
+	w.restarts = append(w.restarts, now)
+	i := 0
+	for i < len(w.restarts) && now.Sub(w.restarts[i]) > window {
+		i++
+	}
+	w.restarts = w.restarts[i:]
+	return len(w.restarts) > max
+}
@@ -0,0 +1,80 @@
+package golet
+
+import (
+	"time"
+)
+
+// Kind represents the kind of a service.
+type Kind int
+
+const (
+	// KindExec is the service which runs a command.
+	KindExec Kind = iota
+	// KindCode is the service which runs a callback.
+	KindCode
+	// KindCron is the service which runs a command or a callback with cron.
+	KindCron
+)
+
+// String returns the name of the kind.
+func (k Kind) String() string {
+	switch k {
+	case KindExec:
+		return "exec"
+	case KindCode:
+		return "code"
+	case KindCron:
+		return "cron"
+	}
+	return "unknown"
+}
+
+// ServiceStatus is the status of a worker.
+type ServiceStatus struct {
+	ID        string    // ID of the worker like "tag.0".
+	Tag       string    // Tag of the service.
+	Kind      Kind      // Kind of the service.
+	State     State     // State of the worker.
+	PID       int       // Process ID of the running command. 0 if it is not running.
+	Port      int       // Assigned port.
+	StartedAt time.Time // Time the current or last run started.
+	Restarts  int       // Number of restarts.
+	ExitCode  int       // Exit code of the last run of the command. -1 if it did not exit normally.
+	Err       error     // Error of the last run.
+	Next      time.Time // Next scheduled run of the cron service.
+}
+
+func (s Service) kind() Kind {
+	switch {
+	case s.isCron():
+		return KindCron
+	case s.isCode():
+		return KindCode
+	}
+	return KindExec
+}
+
+// Status returns the status of each worker.
+func (c *config) Status() []ServiceStatus {
+	next := map[string]time.Time{}
+	c.cronMu.Lock()
+	entries := c.cron.Entries()
+	c.cronMu.Unlock()
+	for _, e := range entries {
+		if job, ok := e.Job.(*cronJob); ok && !job.service.state.isRetired() {
+			next[job.service.id] = e.Next
+		}
+	}
+	services := c.serviceList()
+	statuses := make([]ServiceStatus, 0, len(services))
+	for _, service := range services {
+		status := service.state.status()
+		status.ID = service.id
+		status.Tag = service.Tag
+		status.Kind = service.kind()
+		status.Port = service.ctx.Port()
+		status.Next = next[service.id]
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
@@ -0,0 +1,191 @@
+package golet
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const defaultStopTimeout = 10 * time.Second
+
+// stopping reports whether golet is stopping all services.
+func (c *config) stopping() bool {
+	select {
+	case <-c.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// shutdown stops all services. Services are not restarted after this.
+// received is the signal golet received, or nil if it stops services by itself or by context cancel.
+// sig decides the stop signal of each service as if golet received it. If sig is nil, it means context cancel.
+func (c *config) shutdown(received, sig os.Signal) {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+		c.emit(Event{Type: ShutdownBegun, Signal: received})
+	})
+	if sig == nil && c.cancelSignal < 0 {
+		return
+	}
+	c.notifySignal()
+
+	// Stop services in reverse order of dependencies.
+	// A service is stopped after all services which depend on it are stopped.
+	services := c.serviceList()
+	done := map[string]chan struct{}{}
+	wgs := map[string]*sync.WaitGroup{}
+	for _, service := range services {
+		if _, ok := wgs[service.Tag]; !ok {
+			done[service.Tag] = make(chan struct{})
+			wgs[service.Tag] = &sync.WaitGroup{}
+		}
+		wgs[service.Tag].Add(1)
+	}
+	for tag, wg := range wgs {
+		go func(wg *sync.WaitGroup, done chan struct{}) {
+			wg.Wait()
+			close(done)
+		}(wg, done[tag])
+	}
+	deps := dependents(services)
+	for _, service := range services {
+		go func(service Service) {
+			defer wgs[service.Tag].Done()
+			for _, tag := range deps[service.Tag] {
+				<-done[tag]
+			}
+			if s, ok := c.signalFor(service, sig); ok {
+				c.stopWorker(service, s)
+			}
+		}(service)
+	}
+}
+
+// stopAll stops all services in the same way as SIGTERM, though golet did not receive it.
+// reason is returned by Run as the reason why golet stopped them.
+func (c *config) stopAll(reason error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = reason
+	}
+	c.mu.Unlock()
+	c.shutdown(nil, syscall.SIGTERM)
+}
+
+// exited is called when the worker does not run anymore.
+// If the service is critical, golet stops all services.
+// The context may be canceled before waitSignals starts to stop services, so it is regarded as stopping too.
+func (c *config) exited(service Service) {
+	service.state.exited()
+	if service.Critical && !c.stopping() && c.ctx.Err() == nil && !service.state.isRetired() {
+		service.ctx.Printf("Critical service finished, stop all services\n")
+		c.stopAll(service.state.result(service.id))
+	}
+}
+
+// stopWorker sends the signal to the worker, and waits for it to exit.
+// If the worker does not exit within StopTimeout, golet sends SIGKILL to its processes.
+func (c *config) stopWorker(service Service, sig syscall.Signal) {
+	c.preStop(service)
+	// The worker may be about to start its process, e.g. it has just been launched.
+	for _, p := range service.state.stopFor(sig) {
+		signalProcGroup(p, sig)
+	}
+	// Callbacks can know it by the context.
+	service.state.cancelRun()
+	// Cron services are not finished until cron stops.
+	if service.isCron() {
+		return
+	}
+	c.waitStop(service, service.state.finishedChan())
+}
+
+// waitStop waits for done to be closed until StopTimeout of the service.
+// If it is not closed in time, golet sends SIGKILL to the processes of the worker.
+func (c *config) waitStop(service Service, done <-chan struct{}) {
+	timeout := service.StopTimeout
+	if timeout <= 0 {
+		timeout = defaultStopTimeout
+	}
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-done:
+	case <-t.C:
+		if service.isCode() {
+			service.ctx.Printf("Callback did not return in %s\n", timeout)
+			return
+		}
+		service.ctx.Printf("Process did not exit in %s, send SIGKILL\n", timeout)
+		for _, p := range service.state.processes() {
+			signalProcGroup(p, syscall.SIGKILL)
+		}
+	}
+}
+
+// killAll sends SIGKILL to all processes of services.
+func (c *config) killAll() {
+	for _, service := range c.serviceList() {
+		for _, p := range service.state.processes() {
+			signalProcGroup(p, syscall.SIGKILL)
+		}
+	}
+}
+
+// enter registers a worker or a change of services which keeps golet running until leave is called.
+// Use holdRunning instead unless golet is known to be running, e.g. while launching services.
+func (c *config) enter() {
+	c.mu.Lock()
+	c.active++
+	c.mu.Unlock()
+}
+
+// leave unregisters what enter or holdRunning registered.
+func (c *config) leave() {
+	c.mu.Lock()
+	if c.active--; c.active == 0 {
+		c.idle.Broadcast()
+	}
+	c.mu.Unlock()
+}
+
+// waitShutdown waits for all services to finish. If shutdown timeout is set and
+// services do not finish within it after shutdown, golet kills all processes and gives up waiting.
+func (c *config) waitShutdown() {
+	done := make(chan struct{})
+	go func() {
+		c.mu.Lock()
+		for c.active > 0 {
+			c.idle.Wait()
+		}
+		// Workers cannot be added after this, even if golet gave up waiting by the timeout.
+		c.finished = true
+		c.mu.Unlock()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return
+	case <-c.stop:
+	}
+	if c.shutdownTimeout <= 0 {
+		<-done
+		return
+	}
+	t := time.NewTimer(c.shutdownTimeout)
+	defer t.Stop()
+	select {
+	case <-done:
+	case <-t.C:
+		c.killAll()
+		c.mu.Lock()
+		if c.err == nil {
+			c.err = errors.New("shutdown timeout exceeded")
+		}
+		c.mu.Unlock()
+	}
+}
@@ -0,0 +1,113 @@
+package golet
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/robfig/cron"
+)
+
+// ValidationError describes problems of a service found by Validate.
+type ValidationError struct {
+	Tag      string   // Tag of the service. Empty if it is not set.
+	Arg      string   // Position of the service in arguments of Add like "services[1]". Set only if Tag is empty.
+	Problems []string // Descriptions of the problems.
+}
+
+func (e *ValidationError) Error() string {
+	if e.Tag == "" && e.Arg != "" {
+		return fmt.Sprintf("invalid service %s: %s", e.Arg, strings.Join(e.Problems, ", "))
+	}
+	if e.Tag == "" {
+		return "invalid service: " + strings.Join(e.Problems, ", ")
+	}
+	return fmt.Sprintf("invalid service %q: %s", e.Tag, strings.Join(e.Problems, ", "))
+}
+
+// ValidationErrors is returned by Add when some services are invalid.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate reports problems of the service as *ValidationError, or returns nil if it is valid.
+// Add validates services by it, and adds none of them if some are invalid.
+func (s Service) Validate() error {
+	var problems []string
+	add := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+	switch {
+	case s.Exec == "" && s.Code == nil:
+		add("neither Exec nor Code is set")
+	case s.Exec != "" && s.Code != nil:
+		add("both Exec and Code are set")
+	}
+	// Worker less than 1 means the default.
+	if s.Worker > maxWorkers {
+		add("Worker must be at most %d, got %d", maxWorkers, s.Worker)
+	}
+	if s.Every != "" {
+		if _, err := cron.Parse(s.Every); err != nil {
+			add("invalid cron expression %q: %s", s.Every, err)
+		}
+		if s.Readiness.enabled() || s.Liveness.enabled() {
+			add("probes cannot be used with Every")
+		}
+		// Workers of cron services never finish until golet stops.
+		if s.Critical {
+			add("Critical cannot be used with Every")
+		}
+	}
+	if s.Readiness.Notify {
+		if s.Code == nil {
+			add("Readiness.Notify is only for Code")
+		}
+		if r := s.Readiness; r.TCP || r.HTTP != "" || r.Exec != "" || r.Func != nil {
+			add("Readiness.Notify cannot be used with other checks")
+		}
+	}
+	if s.Liveness.Notify {
+		add("Liveness cannot use Notify")
+	}
+	if s.Restart.String() == "unknown" {
+		add("unknown restart policy: %d", s.Restart)
+	}
+	if s.Backoff.Jitter < 0 || s.Backoff.Jitter > 1 {
+		add("Backoff.Jitter must be between 0 and 1, got %g", s.Backoff.Jitter)
+	}
+	if s.StartRetries < 0 {
+		add("StartRetries must not be negative, got %d", s.StartRetries)
+	}
+	if s.MaxUnavailable < 0 {
+		add("MaxUnavailable must not be negative, got %d", s.MaxUnavailable)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Tag: s.Tag, Problems: problems}
+}
+
+// validate validates services, and returns ValidationErrors if some of them are invalid.
+func validate(services []Service) error {
+	var errs ValidationErrors
+	for i, s := range services {
+		if err := s.Validate(); err != nil {
+			verr := err.(*ValidationError)
+			// Tags are not defaulted yet, so tell which argument is invalid.
+			if verr.Tag == "" {
+				verr.Arg = fmt.Sprintf("services[%d]", i)
+			}
+			errs = append(errs, verr)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}